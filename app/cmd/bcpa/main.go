@@ -0,0 +1,584 @@
+// Command bcpa looks parcels up on the Broward County Property Appraiser site from the command line,
+// using the same parse package as the API.
+//
+//	bcpa lookup --folio 504203060330
+//	bcpa lookup --address "2500 N Ocean Blvd, Fort Lauderdale"
+//	bcpa lookup --file parcels.txt --format csv
+//	bcpa card "http://www.bcpa.net/RecBuildingCard.asp?folio=504203060330&taxyear=2018&cardno=1"
+//	bcpa profile --pages testdata/bcpa profiles/
+//	bcpa replay --archive archive 504203060330
+package main
+
+import (
+	"app/model"
+	"app/shared/address"
+	"app/shared/archive"
+	"app/shared/fetch"
+	"app/shared/lookup"
+	"app/shared/parse"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats
+const (
+	FormatJSON  = "json"
+	FormatTable = "table"
+	FormatCSV   = "csv"
+)
+
+// Result the outcome of looking up one input line
+type Result struct {
+	Input  string      `json:"input"`
+	Record *model.Bcpa `json:"record,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// options the flags shared by every command
+type options struct {
+	format   string
+	baseURL  string
+	fixtures string
+	profile  string
+	archive  string
+	upstream string
+
+	// loaded the profile read from the profile flag, nil for the default
+	loaded *parse.Profile
+	// store the archive opened from the archive flag, nil when not archiving
+	store archive.Store
+	// live the fetcher every lookup of the run shares, so a bulk file keeps to one request budget
+	live *fetch.Live
+}
+
+// register add the shared flags to a command's flag set
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", FormatJSON, "output format: json, table or csv")
+	fs.StringVar(&o.baseURL, "base", lookup.DefaultBaseURL, "BCPA site to query")
+	fs.StringVar(&o.fixtures, "fixtures", "", "answer from the saved pages in this directory instead of the live site")
+	fs.StringVar(&o.profile, "profile", "", "parse with the selector profile in this .json or .yaml file instead of the default")
+	fs.StringVar(&o.archive, "archive", "", "archive the raw pages to this directory or s3://bucket/prefix")
+	fs.StringVar(&o.upstream, "upstream", os.Getenv("BCPA_UPSTREAM"), "request budget for the live site like rps=1,concurrency=2,retries=5,timeout=20s")
+}
+
+// pipeline a lookup pipeline against the live site, or saved pages when --fixtures is given
+func (o *options) pipeline() *lookup.Pipeline {
+
+	var f fetch.Fetcher = o.live
+	if o.fixtures != "" {
+		f = fetch.NewFixtures(o.fixtures)
+	}
+
+	p := lookup.NewPipeline(f, o.baseURL)
+	p.Profile = o.loaded
+	p.Archive = o.store
+
+	return p
+}
+
+// check validate the shared flags and read the profile
+func (o *options) check() error {
+
+	switch o.format {
+	case FormatJSON, FormatTable, FormatCSV:
+	default:
+		return fmt.Errorf("unknown format %q, expected json, table or csv", o.format)
+	}
+
+	if o.profile != "" {
+		p, err := parse.ReadProfile(o.profile)
+		if err != nil {
+			return err
+		}
+		o.loaded = p
+	}
+
+	store, err := archive.Open(o.archive)
+	if err != nil {
+		return err
+	}
+	o.store = store
+
+	polite := fetch.NewPolite()
+	if err = polite.Configure(o.upstream); err != nil {
+		return err
+	}
+	o.live = fetch.NewLiveThrough(polite)
+
+	return nil
+}
+
+const usage = `usage:
+  bcpa lookup (--folio FOLIO | --address ADDRESS | --file FILE) [--format json|table|csv]
+  bcpa card [--format json|table|csv] CARD_URL
+  bcpa profile [--pages DIR] PROFILE...
+  bcpa replay --archive ARCHIVE [--format json|table|csv] KEY
+
+ADDRESS is free text like "2500 N Ocean Blvd, Fort Lauderdale", or the API's address fields
+like "SN=2500&SD=N&HN=OCEAN&ST=BLVD&CT=FL".
+FILE holds one folio or address per line, blank lines and lines starting with # are skipped.
+PROFILE is a selector profile file or a directory of them, each is checked against the saved pages in DIR.
+Every command takes --profile PROFILE_FILE to parse with that profile.
+KEY is an archived lookup like 504203060330/20181017T120000.000000000Z, or a folio for its latest lookup.
+Replay parses the archived pages again and reports if the outcome differs from the archived one.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run the command line, returning the exit status
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	//The drift metrics would end up in the JSON or CSV written to stdout
+	parse.ReportDrift = parse.DriftLogger(stderr)
+
+	var err error
+
+	switch args[0] {
+	case "lookup":
+		err = runLookup(args[1:], stdout, stderr)
+	case "card":
+		err = runCard(args[1:], stdout, stderr)
+	case "profile":
+		err = runProfile(args[1:], stdout, stderr)
+	case "replay":
+		err = runReplay(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "bcpa:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// runLookup look up a folio, an address or a file of them
+func runLookup(args []string, stdout io.Writer, stderr io.Writer) error {
+
+	o := options{}
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	o.register(fs)
+	folio := fs.String("folio", "", "folio / parcel ID to look up")
+	address := fs.String("address", "", "address to look up")
+	file := fs.String("file", "", "file of folios or addresses, one per line")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+
+	inputs := []string{}
+
+	switch {
+	case *file != "":
+		lines, err := readInputs(*file)
+		if err != nil {
+			return err
+		}
+		inputs = lines
+	case *folio != "":
+		inputs = append(inputs, *folio)
+	case *address != "":
+		inputs = append(inputs, *address)
+	default:
+		return errors.New("one of --folio, --address or --file is required")
+	}
+
+	results := make([]Result, 0, len(inputs))
+	failed := 0
+
+	//Keep going on a bad line, a bulk run reports every failure at the end
+	for _, input := range inputs {
+		result := Result{Input: input}
+
+		bcpa, err := lookupInput(context.Background(), o.pipeline(), input)
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		} else {
+			result.Record = &bcpa
+		}
+
+		results = append(results, result)
+	}
+
+	if err := writeResults(stdout, o.format, results, *file != ""); err != nil {
+		return err
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case len(inputs) == 1:
+		return errors.New(results[0].Error)
+	default:
+		return fmt.Errorf("%d of %d lookups failed", failed, len(inputs))
+	}
+}
+
+// lookupInput look up a line that's either a folio or an address
+func lookupInput(ctx context.Context, p *lookup.Pipeline, input string) (model.Bcpa, error) {
+
+	if folio, err := parse.NormalizeFolio(input); err == nil {
+		return p.ByFolio(ctx, folio)
+	}
+
+	a, err := ParseAddress(input)
+	if err != nil {
+		return model.Bcpa{}, err
+	}
+
+	bcpa, err := p.ByAddress(ctx, a)
+
+	//Point at the folios to use instead
+	var ce *lookup.CandidatesError
+	if errors.As(err, &ce) {
+		folios := []string{}
+		for _, c := range ce.Candidates {
+			folios = append(folios, c.Folio)
+		}
+		return bcpa, fmt.Errorf("%s: %s", ce.Error(), strings.Join(folios, ", "))
+	}
+
+	return bcpa, err
+}
+
+// ParseAddress read a free text address, or the address fields in the API's query string form, SN=2500&SD=N&HN=OCEAN&ST=BLVD&CT=FL
+func ParseAddress(s string) (lookup.Address, error) {
+
+	if !strings.Contains(s, "=") {
+		return address.Parse(s)
+	}
+
+	q, err := url.ParseQuery(strings.TrimSpace(s))
+	if err != nil {
+		return lookup.Address{}, fmt.Errorf("invalid address %q: %v", s, err)
+	}
+
+	a := lookup.Address{
+		StreetNumber:    strings.TrimSpace(q.Get("SN")),
+		UnitNumber:      strings.TrimSpace(q.Get("UN")),
+		StreetDirection: strings.TrimSpace(q.Get("SD")),
+		StreetName:      strings.TrimSpace(q.Get("HN")),
+		StreetType:      strings.TrimSpace(q.Get("ST")),
+		PostDirection:   strings.TrimSpace(q.Get("PD")),
+		City:            strings.TrimSpace(q.Get("CT")),
+	}
+
+	if a.StreetNumber == "" || a.StreetName == "" {
+		return lookup.Address{}, fmt.Errorf("invalid address %q: SN and HN are required", s)
+	}
+
+	return a, nil
+}
+
+// readInputs read the folios / addresses of a bulk file, "-" reads standard input
+func readInputs(name string) ([]string, error) {
+
+	var r io.Reader = os.Stdin
+
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	inputs := []string{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		inputs = append(inputs, line)
+	}
+
+	return inputs, scanner.Err()
+}
+
+// resultColumns the summary columns of the table and CSV output
+var resultColumns = []string{"input", "folio", "owner", "site address", "use", "adj bldg sf", "cards", "errors"}
+
+// resultRow summary of a result, the errors column carries the lookup error or the sections that failed
+func resultRow(r Result) []string {
+
+	if r.Record == nil {
+		return []string{r.Input, "", "", "", "", "", "", r.Error}
+	}
+
+	b := r.Record
+	sections := []string{}
+	for _, e := range b.Errors {
+		sections = append(sections, e.Section+": "+e.Cause)
+	}
+
+	return []string{
+		r.Input,
+		b.ID,
+		b.Owner,
+		b.Siteaddress,
+		b.Use,
+		b.LandCalculations.AdjBldgSF,
+		strconv.Itoa(len(b.LandCalculations.Cards)),
+		strings.Join(sections, "; "),
+	}
+}
+
+// writeResults print the results, a single lookup prints its record on its own in JSON
+func writeResults(w io.Writer, format string, results []Result, bulk bool) error {
+
+	switch format {
+	case FormatTable:
+		rows := [][]string{}
+		for _, r := range results {
+			rows = append(rows, resultRow(r))
+		}
+		return writeTable(w, resultColumns, rows)
+	case FormatCSV:
+		rows := [][]string{resultColumns}
+		for _, r := range results {
+			rows = append(rows, resultRow(r))
+		}
+		return writeCSV(w, rows)
+	}
+
+	if !bulk {
+		if results[0].Record == nil {
+			return nil
+		}
+		return writeJSON(w, results[0].Record)
+	}
+
+	return writeJSON(w, results)
+}
+
+// runCard fetch and print a single building card
+func runCard(args []string, stdout io.Writer, stderr io.Writer) error {
+
+	o := options{}
+	fs := flag.NewFlagSet("card", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	o.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("card takes exactly one card URL")
+	}
+
+	card, err := o.pipeline().Card(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fields := cardFields(card)
+
+	switch o.format {
+	case FormatTable:
+		return writeTable(stdout, []string{"field", "value"}, fields)
+	case FormatCSV:
+		header, row := []string{}, []string{}
+		for _, f := range fields {
+			header, row = append(header, f[0]), append(row, f[1])
+		}
+		return writeCSV(stdout, [][]string{header, row})
+	}
+
+	return writeJSON(stdout, card)
+}
+
+// cardFields the card values as field / value pairs, permits and features are counted
+func cardFields(c model.RecBuildingCard) [][]string {
+	return [][]string{
+		{"folio", c.Folio},
+		{"taxyear", c.TaxYear},
+		{"cardno", c.CardNo},
+		{"parcelidnumber", c.ParcelIDNumber},
+		{"usecode", c.UseCode},
+		{"nobedrooms", c.NoBedrooms},
+		{"nobaths", c.NoBaths},
+		{"nounits", c.NoUnits},
+		{"nostories", c.NoStories},
+		{"nobuildings", c.NoBuildings},
+		{"foundation", c.Foundation},
+		{"exterior", c.Exterior},
+		{"rooftype", c.RoofType},
+		{"roofmaterial", c.RoofMaterial},
+		{"interior", c.Interior},
+		{"floors", c.Floors},
+		{"plumbing", c.Plumbing},
+		{"electric", c.Electric},
+		{"classification", c.Classification},
+		{"ceilingheights", c.CeilingHeights},
+		{"qualityofconstruction", c.QualityOfConstruction},
+		{"currentconditionstructure", c.CurrentConditionStructure},
+		{"constructionclass", c.ConstructionClass},
+		{"permits", strconv.Itoa(len(c.Permits))},
+		{"extrafeatures", strconv.Itoa(len(c.ExtraFeatures))},
+	}
+}
+
+// writeJSON print v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeTable print the rows as aligned columns under an upper case header
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	upper := []string{}
+	for _, h := range header {
+		upper = append(upper, strings.ToUpper(h))
+	}
+	fmt.Fprintln(tw, strings.Join(upper, "\t"))
+
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// writeCSV print the rows as CSV
+func writeCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// runProfile check selector profiles against saved pages, listing every selector that matches nothing
+func runProfile(args []string, stdout io.Writer, stderr io.Writer) error {
+
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pages := fs.String("pages", "testdata/bcpa", "directory of saved parcel and card pages")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("profile takes at least one profile file or directory")
+	}
+
+	failed := 0
+
+	for _, path := range fs.Args() {
+
+		ps, err := parse.LoadProfiles(path)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range ps.Versions() {
+			p, _ := ps.Get(version)
+
+			errs := parse.ValidateProfile(p, *pages)
+			for _, err := range errs {
+				fmt.Fprintln(stdout, err)
+			}
+			if len(errs) > 0 {
+				failed++
+				continue
+			}
+
+			fmt.Fprintf(stdout, "profile %s ok\n", version)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d profile(s) don't match the pages in %s", failed, *pages)
+	}
+
+	return nil
+}
+
+// runReplay parse an archived lookup again with this build, to check a parser fix against the pages that broke
+func runReplay(args []string, stdout io.Writer, stderr io.Writer) error {
+
+	o := options{}
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	o.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+	if o.store == nil {
+		return errors.New("replay needs --archive")
+	}
+	if fs.NArg() != 1 {
+		return errors.New("replay takes exactly one archive key or folio")
+	}
+
+	replayed, err := lookup.Replay(context.Background(), o.store, fs.Arg(0), o.loaded)
+	if err != nil {
+		return err
+	}
+
+	m := replayed.Manifest
+	if m.Error != replayed.Error {
+		fmt.Fprintf(stderr, "outcome changed since %s: archived %q, replayed %q\n", m.StartedAt.Format("2006-01-02 15:04:05"), m.Error, replayed.Error)
+	}
+
+	switch {
+	case o.format == FormatJSON:
+		err = writeJSON(stdout, replayed)
+	case replayed.Results != nil:
+		err = fmt.Errorf("%s lookups replay as json only", m.Lookup)
+	default:
+		err = writeResults(stdout, o.format, []Result{{Input: m.Key, Record: replayed.Record, Error: replayed.Error}}, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	if replayed.Error != "" {
+		return errors.New(replayed.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"app/model"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fixtures = "../../../testdata/bcpa"
+
+func TestLookupFolio(t *testing.T) {
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run([]string{"lookup", "--fixtures", fixtures, "--folio", "5042-03-06-0330"}, stdout, stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+
+	bcpa := model.Bcpa{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &bcpa))
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Equal(t, "SMITH, JOHN & SMITH, JANE", bcpa.Owner)
+}
+
+func TestLookupAddressTable(t *testing.T) {
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run([]string{"lookup", "--fixtures", fixtures, "--format", "table", "--address", "2500 N Ocean Blvd, Fort Lauderdale"}, stdout, stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+	assert.Contains(t, stdout.String(), "FOLIO")
+	assert.Contains(t, stdout.String(), "494210010020")
+}
+
+func TestLookupFileCSV(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "parcels.txt")
+	assert.Nil(t, os.WriteFile(file, []byte("# folios and addresses\n504203060330\n\nSN=100&SD=E&HN=LAS OLAS&ST=BLVD&CT=FL\n"), 0644))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run([]string{"lookup", "--fixtures", fixtures, "--format", "csv", "--file", file}, stdout, stderr)
+
+	//The ambiguous address fails the run but not the other lines
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr.String(), "1 of 2 lookups failed")
+
+	rows, err := csv.NewReader(stdout).ReadAll()
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, resultColumns, rows[0])
+		assert.Equal(t, "504203060330", rows[1][1])
+		assert.Equal(t, "", rows[2][1])
+		assert.Contains(t, rows[2][7], "504211020010")
+	}
+}
+
+func TestCard(t *testing.T) {
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run([]string{"card", "--fixtures", fixtures, "http://www.bcpa.net/RecBuildingCard.asp?folio=504203060330&taxyear=2018&cardno=1"}, stdout, stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+
+	card := model.RecBuildingCard{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &card))
+	assert.Equal(t, "3", card.NoBedrooms)
+	assert.Equal(t, "CB Stucco", card.Exterior)
+}
+
+func TestProfile(t *testing.T) {
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run([]string{"profile", "--pages", fixtures, "../../../profiles"}, stdout, stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+	assert.Contains(t, stdout.String(), "profile 2018.1 ok")
+
+	//A card field pointed at a table the pages don't have
+	broken := filepath.Join(t.TempDir(), "broken.json")
+	assert.Nil(t, os.WriteFile(broken, []byte(`{"version": "2019.1", "card": {"nobaths": "#Table99 p"}}`), 0644))
+
+	stdout.Reset()
+	status = run([]string{"profile", "--pages", fixtures, broken}, stdout, stderr)
+
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout.String(), `card field "nobaths"`)
+}
+
+func TestReplay(t *testing.T) {
+
+	archive := t.TempDir()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run([]string{"lookup", "--fixtures", fixtures, "--archive", archive, "--folio", "504203060330"}, stdout, stderr)
+	assert.Equal(t, 0, status, stderr.String())
+
+	//The replay reads only the archive, no fixtures
+	replayed := &bytes.Buffer{}
+	status = run([]string{"replay", "--archive", archive, "504203060330"}, replayed, stderr)
+	assert.Equal(t, 0, status, stderr.String())
+
+	result := struct {
+		Manifest struct {
+			Lookup string
+			Pages  []struct{ Name string }
+		}
+		Record model.Bcpa
+	}{}
+	assert.Nil(t, json.Unmarshal(replayed.Bytes(), &result))
+	assert.Equal(t, "folio", result.Manifest.Lookup)
+	assert.Len(t, result.Manifest.Pages, 3)
+	assert.Equal(t, "SMITH, JOHN & SMITH, JANE", result.Record.Owner)
+
+	status = run([]string{"replay", "--archive", archive, "494210010020"}, replayed, stderr)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr.String(), "no archived lookups of 494210010020")
+}
+
+func TestParseAddress(t *testing.T) {
+
+	a, err := ParseAddress("SN=2500&SD=N&HN=OCEAN&ST=BLVD&CT=FL")
+	assert.Nil(t, err)
+	assert.Equal(t, "2500", a.StreetNumber)
+	assert.Equal(t, "OCEAN", a.StreetName)
+	assert.Equal(t, "FL", a.City)
+
+	_, err = ParseAddress("SD=N&ST=BLVD")
+	assert.NotNil(t, err)
+
+	a, err = ParseAddress("2500 N Ocean Blvd, Fort Lauderdale")
+	assert.Nil(t, err)
+	assert.Equal(t, "OCEAN", a.StreetName)
+	assert.Equal(t, "BLVD", a.StreetType)
+}
@@ -16,11 +16,23 @@ type Bcpa struct {
 	SalesHistory        []Sale
 	LandCalculations    LandCalculations
 	SpecialAssessments  []SpecialAssessment
+	Errors              []SectionError    `json:"errors,omitempty"`
+	Strategies          map[string]string `json:"strategies,omitempty"`
+	Provenance          *Provenance       `json:"provenance,omitempty"`
+	// Incomplete the lookup ran out of time, the sections it didn't get to are in Errors
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// SectionError a section of the record that failed to load and why
+type SectionError struct {
+	Section string `json:"section"`
+	Cause   string `json:"cause"`
 }
 
 // RecBuildingCard Card page Structure
 type RecBuildingCard struct {
 	CardURL                   string `json:"cardurl"`
+	CardNo                    string `json:"cardno"`
 	TaxYear                   string `json:"taxyear"`
 	Folio                     string `json:"folio"`
 	ParcelIDNumber            string `json:"parcelidnumber"`
@@ -67,8 +79,9 @@ type LandCalculations struct {
 	AdjBldgSF       string `json:"adjbldgsf"`
 	Units           string `json:"units"`
 	Cards           []RecBuildingCard
-	SketchURL       string `json:"sketchurl"`
-	EffActYearBuilt string `json:"effactyearbuilt"`
+	SketchURL       string            `json:"sketchurl"`
+	Sketch          *RecPatriotSketch `json:"sketch,omitempty"`
+	EffActYearBuilt string            `json:"effactyearbuilt"`
 }
 
 // LandCalculation land calculation structure
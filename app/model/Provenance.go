@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Provenance where a record came from and what parsed it, for the audit trail
+type Provenance struct {
+	// ParserVersion the build of the parser
+	ParserVersion string `json:"parserVersion"`
+	// ProfileVersion the selector profile the pages were parsed with
+	ProfileVersion string `json:"profileVersion"`
+	// Sources the pages fetched, in the order they were fetched
+	Sources []Source `json:"sources,omitempty"`
+}
+
+// Source one upstream page a record was built from
+type Source struct {
+	// Section the part of the record the page fed, parcel, card 1, sketch...
+	Section   string    `json:"section"`
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	// SHA256 hex digest of the raw HTML as fetched
+	SHA256 string `json:"sha256"`
+}
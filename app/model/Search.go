@@ -0,0 +1,15 @@
+package model
+
+// ParcelSearchResult row of the BCPA search results grid
+type ParcelSearchResult struct {
+	Folio       string     `json:"folio"`
+	Owner       string     `json:"owner"`
+	Siteaddress string     `json:"siteaddress"`
+	Use         string     `json:"use"`
+	Bcpa        *Bcpa      `json:"bcpa,omitempty"`
+	Typed       *TypedBcpa `json:"typed,omitempty"`
+	// Incomplete the lookup ran out of time before it loaded the record
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Error why the record of this parcel couldn't be loaded, the other results still have theirs
+	Error string `json:"error,omitempty"`
+}
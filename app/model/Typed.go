@@ -0,0 +1,186 @@
+package model
+
+import "time"
+
+// Money currency value in cents along with the raw text it came from
+type Money struct {
+	Cents  int64  `json:"cents"`
+	Raw    string `json:"raw"`
+	Failed bool   `json:"failed,omitempty"`
+}
+
+// Date date value along with the raw text it came from
+type Date struct {
+	Time   time.Time `json:"time"`
+	Raw    string    `json:"raw"`
+	Failed bool      `json:"failed,omitempty"`
+}
+
+// Int whole number value (counts, years) along with the raw text it came from
+type Int struct {
+	Value  int    `json:"value"`
+	Raw    string `json:"raw"`
+	Failed bool   `json:"failed,omitempty"`
+}
+
+// Number decimal value (square footage, factors, baths) along with the raw text it came from
+type Number struct {
+	Value  float64 `json:"value"`
+	Raw    string  `json:"raw"`
+	Failed bool    `json:"failed,omitempty"`
+}
+
+// TypedBcpa normalized companion of Bcpa
+type TypedBcpa struct {
+	Siteaddress         string `json:"siteaddress"`
+	Owner               string `json:"owner"`
+	MailingAddress      string `json:"mailingAddress"`
+	ID                  string `json:"id"`
+	Milage              string `json:"milage"`
+	Use                 string `json:"use"`
+	Legal               string `json:"legal"`
+	PropertyAssessments []TypedPropertyAssessmentValue
+	ExemptionsTaxable   TypedExemptionsTaxableValuesbyTaxingAuthority
+	SalesHistory        []TypedSale
+	LandCalculations    TypedLandCalculations
+	SpecialAssessments  []TypedSpecialAssessment
+	Errors              []SectionError    `json:"errors,omitempty"`
+	Strategies          map[string]string `json:"strategies,omitempty"`
+	Provenance          *Provenance       `json:"provenance,omitempty"`
+	Incomplete          bool              `json:"incomplete,omitempty"`
+}
+
+// TypedPropertyAssessmentValue normalized companion of PropertyAssessmentValue
+type TypedPropertyAssessmentValue struct {
+	Year                Int       `json:"year"`
+	Land                Money     `json:"land"`
+	BuildingImprovement Money     `json:"buildingimprovement"`
+	JustMarketValue     Money     `json:"justmarketvalue"`
+	AssessedSOHValue    Money     `json:"assessedsohvalue"`
+	Tax                 Money     `json:"tax"`
+	CreatedAt           time.Time `json:"createdat"`
+	UpdatedAt           time.Time `json:"updatedat"`
+}
+
+// TypedExemptionsTaxableValuesbyTaxingAuthority normalized companion of ExemptionsTaxableValuesbyTaxingAuthority
+type TypedExemptionsTaxableValuesbyTaxingAuthority struct {
+	County      TypedExemptionsAndTaxableValue
+	SchoolBoard TypedExemptionsAndTaxableValue
+	Municipal   TypedExemptionsAndTaxableValue
+	Independent TypedExemptionsAndTaxableValue
+	CreatedAt   time.Time `json:"createdat"`
+	UpdatedAt   time.Time `json:"updatedat"`
+}
+
+// TypedExemptionsAndTaxableValue normalized companion of ExemptionsAndTaxableValue
+type TypedExemptionsAndTaxableValue struct {
+	JustValue    Money  `json:"justvalue"`
+	Portability  Money  `json:"portability"`
+	AssessedSOH  Money  `json:"assessedsoh"`
+	Homestead    Money  `json:"homestead"`
+	AddHomestead Money  `json:"addhomestead"`
+	WidVetDis    Money  `json:"widvetdis"`
+	Senior       Money  `json:"senior"`
+	XemptType    string `json:"xempttype"`
+	Taxable      Money  `json:"taxable"`
+}
+
+// TypedSale normalized companion of Sale
+type TypedSale struct {
+	Date        Date   `json:"date"`
+	Type        string `json:"type"`
+	Price       Money  `json:"price"`
+	BookPageCIN string `json:"bookpagecin"`
+}
+
+// TypedLandCalculations normalized companion of LandCalculations
+type TypedLandCalculations struct {
+	Calculations    []TypedLandCalculation
+	AdjBldgSF       Number `json:"adjbldgsf"`
+	Units           Int    `json:"units"`
+	Cards           []TypedRecBuildingCard
+	SketchURL       string                 `json:"sketchurl"`
+	Sketch          *TypedRecPatriotSketch `json:"sketch,omitempty"`
+	EffActYearBuilt string                 `json:"effactyearbuilt"`
+	EffYearBuilt    Int                    `json:"effyearbuilt"`
+	ActYearBuilt    Int                    `json:"actyearbuilt"`
+}
+
+// TypedLandCalculation normalized companion of LandCalculation
+type TypedLandCalculation struct {
+	Price  Money  `json:"price"`
+	Factor Number `json:"factor"`
+	Type   string `json:"type"`
+}
+
+// TypedRecBuildingCard normalized companion of RecBuildingCard
+type TypedRecBuildingCard struct {
+	CardURL                   string `json:"cardurl"`
+	CardNo                    string `json:"cardno"`
+	TaxYear                   Int    `json:"taxyear"`
+	Folio                     string `json:"folio"`
+	ParcelIDNumber            string `json:"parcelidnumber"`
+	UseCode                   string `json:"usecode"`
+	NoBedrooms                Int    `json:"nobedrooms"`
+	NoBaths                   Number `json:"nobaths"`
+	NoUnits                   Int    `json:"nounits"`
+	NoStories                 Number `json:"nostories"`
+	NoBuildings               Int    `json:"nobuildings"`
+	Foundation                string `json:"foundation"`
+	Exterior                  string `json:"exterior"`
+	RoofType                  string `json:"rooftype"`
+	RoofMaterial              string `json:"roofmaterial"`
+	Interior                  string `json:"interior"`
+	Floors                    string `json:"floors"`
+	Plumbing                  string `json:"plumbing"`
+	Electric                  string `json:"electric"`
+	Classification            string `json:"classification"`
+	CeilingHeights            string `json:"ceilingheights"`
+	QualityOfConstruction     string `json:"qualityofconstruction"`
+	CurrentConditionStructure string `json:"currentconditionstructure"`
+	ConstructionClass         string `json:"constructionclass"`
+	Permits                   []TypedPermit
+	ExtraFeatures             []ExtraFeature
+}
+
+// TypedPermit normalized companion of Permit
+type TypedPermit struct {
+	PermitNo   string `json:"permitco"`
+	PermitType string `json:"permittype"`
+	EstCost    Money  `json:"estcost"`
+	PermitDate Date   `json:"permitdate"`
+	CODate     Date   `json:"codate"`
+}
+
+// TypedRecPatriotSketch normalized companion of RecPatriotSketch
+type TypedRecPatriotSketch struct {
+	Sketch       string `json:"sketch"`
+	Building     string `json:"building"`
+	URL          string `json:"url"`
+	SketchImgURL string `json:"sketchimgurl"`
+	Codes        []TypedPatriotSketchCode
+	AdjAreaTotal Number `json:"adjareatotal"`
+}
+
+// TypedPatriotSketchCode normalized companion of PatriotSketchCode
+type TypedPatriotSketchCode struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Area        Number `json:"area"`
+	Factor      Number `json:"factor"`
+	AdjArea     Number `json:"adjarea"`
+	Stories     Number `json:"stories"`
+}
+
+// TypedSpecialAssessment normalized companion of SpecialAssessment
+type TypedSpecialAssessment struct {
+	Fire  Money `json:"fire"`
+	Garb  Money `json:"garb"`
+	Light Money `json:"light"`
+	Drain Money `json:"drain"`
+	Impr  Money `json:"impr"`
+	Safe  Money `json:"safe"`
+	Storm Money `json:"storm"`
+	Clean Money `json:"clean"`
+	Misc  Money `json:"misc"`
+}
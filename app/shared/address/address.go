@@ -0,0 +1,242 @@
+package address
+
+import (
+	"app/shared/lookup"
+	"app/shared/problem"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	//A house number, optionally with a letter like 1234A
+	numberRe = regexp.MustCompile(`^[0-9]+[A-Z]?$`)
+
+	//A range like 1234-1236 could be either number
+	rangeRe = regexp.MustCompile(`^([0-9]+)-([0-9]+)$`)
+
+	//Ordinal street names like 5TH, the form takes the bare number
+	ordinalRe = regexp.MustCompile(`^([0-9]+)(ST|ND|RD|TH)$`)
+
+	zipRe = regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`)
+)
+
+// AmbiguityError the address reads more than one way, the caller has to say which
+type AmbiguityError struct {
+	Input string
+	// Field the form field in doubt, SN, UN, CT ...
+	Field    string
+	Readings []string
+}
+
+func (e *AmbiguityError) Error() string {
+	return fmt.Sprintf("ambiguous address %q, %s could be %s", e.Input, e.Field, strings.Join(e.Readings, " or "))
+}
+
+// Unwrap carries the validation catalogue code
+func (e *AmbiguityError) Unwrap() error {
+	return problem.New(problem.CodeValidation, e.Error())
+}
+
+// Parser splits free text addresses into the RecAddr.asp form fields
+type Parser struct {
+	// Cities city codes keyed by upper case city name
+	Cities map[string]string
+}
+
+// NewParser a parser knowing the Broward municipalities
+func NewParser() *Parser {
+	return &Parser{Cities: DefaultCities}
+}
+
+// Parse split an address like "1234 NE 5th Ave Apt 2, Fort Lauderdale" with the default parser
+func Parse(raw string) (lookup.Address, error) {
+	return NewParser().Parse(raw)
+}
+
+// Parse split an address like "1234 NE 5th Ave Apt 2, Fort Lauderdale" into the form fields.
+// It fails rather than guess when part of the address reads more than one way
+func (p *Parser) Parse(raw string) (lookup.Address, error) {
+
+	a := lookup.Address{}
+
+	invalid := func(format string, args ...interface{}) (lookup.Address, error) {
+		return lookup.Address{}, problem.New(problem.CodeValidation, fmt.Sprintf("invalid address %q: ", raw)+fmt.Sprintf(format, args...))
+	}
+
+	//Upper case, drop the dots of N.E. and St. and keep the commas as separators
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.NewReplacer(".", "", "\t", " ", ",", " , ", "#", " # ").Replace(s)
+
+	tokens := strings.Fields(s)
+	if len(tokens) == 0 {
+		return invalid("empty")
+	}
+
+	//Remember where the first comma was, a city code only counts on its own after one
+	comma := len(tokens)
+	street := []string{}
+	for _, t := range tokens {
+		if t == "," {
+			if comma == len(tokens) {
+				comma = len(street)
+			}
+			continue
+		}
+		street = append(street, t)
+	}
+	if comma > len(street) {
+		comma = len(street)
+	}
+
+	//State and ZIP code on the end
+	state := ""
+	if n := len(street); n > 0 && zipRe.MatchString(street[n-1]) {
+		street = street[:n-1]
+		state = "ZIP"
+	}
+	if n := len(street); n > 0 && (street[n-1] == "FL" || street[n-1] == "FLA" || street[n-1] == "FLORIDA") {
+		if street[n-1] != "FL" || state != "" {
+			state = street[n-1]
+			street = street[:n-1]
+		} else {
+			state = "FL?"
+		}
+	}
+
+	//City name, the longest run of trailing words that names one, leaving at least a number and a street name
+	for size := 4; size > 0; size-- {
+		n := len(street) - size
+		if state == "FL?" {
+			n--
+		}
+		if n < 2 {
+			continue
+		}
+
+		if code, ok := p.city(strings.Join(street[n:n+size], " ")); ok {
+			a.City = code
+			street = street[:n]
+
+			//A bare FL after a city name is the state
+			if state == "FL?" {
+				state = "FL"
+			}
+			break
+		}
+	}
+
+	//A bare FL with no city name is either Fort Lauderdale's city code or the state
+	if state == "FL?" {
+		return lookup.Address{}, &AmbiguityError{raw, "CT", []string{"the city code FL", "the state of Florida"}}
+	}
+
+	//A city code on its own after the comma
+	if a.City == "" && comma < len(street) && len(street)-comma == 1 && p.hasCode(street[comma]) {
+		a.City = street[comma]
+		street = street[:comma]
+	}
+
+	if comma < len(street) && a.City == "" {
+		return invalid("unknown city %q", strings.Join(street[comma:], " "))
+	}
+
+	if len(street) == 0 {
+		return invalid("missing street number")
+	}
+
+	//House number
+	if m := rangeRe.FindStringSubmatch(street[0]); m != nil {
+		return lookup.Address{}, &AmbiguityError{raw, "SN", []string{m[1], m[2]}}
+	}
+	if !numberRe.MatchString(street[0]) {
+		return invalid("missing street number")
+	}
+	a.StreetNumber = street[0]
+	street = street[1:]
+
+	//Unit, after a designator like APT, UNIT or #
+	for i := 0; i < len(street); i++ {
+		if !UnitDesignators[street[i]] {
+			continue
+		}
+		if i+1 >= len(street) {
+			return invalid("missing unit number after %s", street[i])
+		}
+		if i+2 < len(street) {
+			return invalid("unexpected %q after the unit number", strings.Join(street[i+2:], " "))
+		}
+		a.UnitNumber = street[i+1]
+		street = street[:i]
+		break
+	}
+
+	//A bare number after the street type is a unit or part of the street name, e.g. State Road 7
+	if n := len(street); a.UnitNumber == "" && n >= 3 && numberRe.MatchString(street[n-1]) {
+		if _, ok := Suffixes[street[n-2]]; ok {
+			return lookup.Address{}, &AmbiguityError{raw, "UN", []string{"unit " + street[n-1], "part of the street name " + strings.Join(street, " ")}}
+		}
+	}
+
+	//Post direction, only after a street type like Ocean Blvd N
+	if n := len(street); n >= 3 {
+		if d, ok := Directionals[street[n-1]]; ok {
+			if _, ok := Suffixes[street[n-2]]; ok {
+				a.PostDirection = d
+				street = street[:n-1]
+			}
+		}
+	}
+
+	//Street type, as long as something is left for the name
+	if n := len(street); n >= 2 {
+		if st, ok := Suffixes[street[n-1]]; ok {
+			a.StreetType = st
+			street = street[:n-1]
+		}
+	}
+
+	//Direction, as long as something is left for the name, 100 North Ave is North Avenue
+	if len(street) >= 2 {
+		if d, ok := Directionals[street[0]]; ok {
+			a.StreetDirection = d
+			street = street[1:]
+		}
+	}
+
+	if len(street) == 0 {
+		return invalid("missing street name")
+	}
+
+	for i, t := range street {
+		if m := ordinalRe.FindStringSubmatch(t); m != nil {
+			street[i] = m[1]
+		}
+	}
+	a.StreetName = strings.Join(street, " ")
+
+	return a, nil
+}
+
+// city code of a city name, alias or code
+func (p *Parser) city(name string) (string, bool) {
+
+	name = strings.Replace(name, "-", " ", -1)
+
+	if alias, ok := cityAliases[name]; ok {
+		name = alias
+	}
+
+	code, ok := p.Cities[name]
+	return code, ok
+}
+
+// hasCode check if a value is one of the city codes
+func (p *Parser) hasCode(code string) bool {
+	for _, c := range p.Cities {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package address
+
+import (
+	"app/shared/lookup"
+	"app/shared/problem"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+
+	a, err := Parse("1234 NE 5th Ave Apt 2, Fort Lauderdale")
+	assert.Nil(t, err)
+	assert.Equal(t, lookup.Address{StreetNumber: "1234", UnitNumber: "2", StreetDirection: "NE", StreetName: "5", StreetType: "AVE", City: "FL"}, a)
+
+	a, err = Parse("2500 N. Ocean Boulevard, Ft. Lauderdale, FL 33305")
+	assert.Nil(t, err)
+	assert.Equal(t, lookup.Address{StreetNumber: "2500", StreetDirection: "N", StreetName: "OCEAN", StreetType: "BLVD", City: "FL"}, a)
+
+	a, err = Parse("100 East Las Olas Blvd #1 Fort Lauderdale FL")
+	assert.Nil(t, err)
+	assert.Equal(t, lookup.Address{StreetNumber: "100", UnitNumber: "1", StreetDirection: "E", StreetName: "LAS OLAS", StreetType: "BLVD", City: "FL"}, a)
+
+	a, err = Parse("4100 Galt Ocean Dr N Unit 1204, Lauderdale-By-The-Sea")
+	assert.Nil(t, err)
+	assert.Equal(t, lookup.Address{StreetNumber: "4100", UnitNumber: "1204", StreetName: "GALT OCEAN", StreetType: "DR", PostDirection: "N", City: "LS"}, a)
+
+	//A lone direction or street type word is the name
+	a, err = Parse("10 North Ave")
+	assert.Nil(t, err)
+	assert.Equal(t, lookup.Address{StreetNumber: "10", StreetName: "NORTH", StreetType: "AVE"}, a)
+
+	a, err = Parse("1200 Hollywood Blvd, HW")
+	assert.Nil(t, err)
+	assert.Equal(t, "HOLLYWOOD", a.StreetName)
+	assert.Equal(t, "HW", a.City)
+}
+
+func TestParseAmbiguous(t *testing.T) {
+
+	for input, field := range map[string]string{
+		"1234 NE 5th Ave, FL":    "CT",
+		"1234-1236 NE 5th Ave":   "SN",
+		"4000 N State Road 7":    "UN",
+		"1234 NE 5th Ave FL":     "CT",
+		"1 SW 2 St 3, Fort Laud": "UN",
+	} {
+		_, err := Parse(input)
+
+		var ae *AmbiguityError
+		if assert.True(t, errors.As(err, &ae), input) {
+			assert.Equal(t, field, ae.Field, input)
+			assert.Len(t, ae.Readings, 2, input)
+		}
+		assert.Equal(t, problem.CodeValidation, problem.CodeOf(err), input)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+
+	for _, input := range []string{"", "NE 5th Ave", "1234 Apt 2", "1234 NE 5th Ave, Springfield", "1234 NE 5th Ave Apt"} {
+		_, err := Parse(input)
+		assert.NotNil(t, err, input)
+		assert.Equal(t, problem.CodeValidation, problem.CodeOf(err), input)
+	}
+}
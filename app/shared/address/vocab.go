@@ -0,0 +1,137 @@
+package address
+
+// Directionals spellings of a street direction and the form value they map to
+var Directionals = map[string]string{
+	"N":         "N",
+	"NORTH":     "N",
+	"S":         "S",
+	"SOUTH":     "S",
+	"E":         "E",
+	"EAST":      "E",
+	"W":         "W",
+	"WEST":      "W",
+	"NE":        "NE",
+	"NORTHEAST": "NE",
+	"NW":        "NW",
+	"NORTHWEST": "NW",
+	"SE":        "SE",
+	"SOUTHEAST": "SE",
+	"SW":        "SW",
+	"SOUTHWEST": "SW",
+}
+
+// Suffixes spellings of a street type and the USPS abbreviation the form takes
+var Suffixes = map[string]string{
+	"ALLEY":     "ALY",
+	"ALY":       "ALY",
+	"AVENUE":    "AVE",
+	"AVE":       "AVE",
+	"AV":        "AVE",
+	"BOULEVARD": "BLVD",
+	"BLVD":      "BLVD",
+	"CAUSEWAY":  "CSWY",
+	"CSWY":      "CSWY",
+	"CIRCLE":    "CIR",
+	"CIR":       "CIR",
+	"COURT":     "CT",
+	"CT":        "CT",
+	"COVE":      "CV",
+	"CV":        "CV",
+	"CRESCENT":  "CRES",
+	"CRES":      "CRES",
+	"DRIVE":     "DR",
+	"DR":        "DR",
+	"HIGHWAY":   "HWY",
+	"HWY":       "HWY",
+	"ISLE":      "ISLE",
+	"LANE":      "LN",
+	"LN":        "LN",
+	"LOOP":      "LOOP",
+	"PARKWAY":   "PKWY",
+	"PKWY":      "PKWY",
+	"PASS":      "PASS",
+	"PATH":      "PATH",
+	"PLACE":     "PL",
+	"PL":        "PL",
+	"PLAZA":     "PLZ",
+	"PLZ":       "PLZ",
+	"POINT":     "PT",
+	"PT":        "PT",
+	"ROAD":      "RD",
+	"RD":        "RD",
+	"ROW":       "ROW",
+	"RUN":       "RUN",
+	"SQUARE":    "SQ",
+	"SQ":        "SQ",
+	"STREET":    "ST",
+	"ST":        "ST",
+	"STR":       "ST",
+	"TERRACE":   "TER",
+	"TER":       "TER",
+	"TERR":      "TER",
+	"TRAIL":     "TRL",
+	"TRL":       "TRL",
+	"WALK":      "WALK",
+	"WAY":       "WAY",
+	"WY":        "WAY",
+}
+
+// UnitDesignators words that introduce a unit number
+var UnitDesignators = map[string]bool{
+	"APT":       true,
+	"APARTMENT": true,
+	"UNIT":      true,
+	"STE":       true,
+	"SUITE":     true,
+	"#":         true,
+}
+
+// DefaultCities the Broward municipalities and their city codes, keyed by upper case name
+var DefaultCities = map[string]string{
+	"COCONUT CREEK":         "CC",
+	"COOPER CITY":           "CO",
+	"CORAL SPRINGS":         "CS",
+	"DANIA BEACH":           "DN",
+	"DAVIE":                 "DA",
+	"DEERFIELD BEACH":       "DB",
+	"FORT LAUDERDALE":       "FL",
+	"HALLANDALE BEACH":      "HA",
+	"HILLSBORO BEACH":       "HB",
+	"HOLLYWOOD":             "HW",
+	"LAUDERDALE BY THE SEA": "LS",
+	"LAUDERDALE LAKES":      "LL",
+	"LAUDERHILL":            "LH",
+	"LAZY LAKE":             "LZ",
+	"LIGHTHOUSE POINT":      "LP",
+	"MARGATE":               "MA",
+	"MIRAMAR":               "MM",
+	"NORTH LAUDERDALE":      "NL",
+	"OAKLAND PARK":          "OP",
+	"PARKLAND":              "PA",
+	"PEMBROKE PARK":         "PK",
+	"PEMBROKE PINES":        "PI",
+	"PLANTATION":            "PL",
+	"POMPANO BEACH":         "PB",
+	"SEA RANCH LAKES":       "SR",
+	"SOUTHWEST RANCHES":     "SW",
+	"SUNRISE":               "SU",
+	"TAMARAC":               "TA",
+	"WEST PARK":             "WP",
+	"WESTON":                "WS",
+	"WILTON MANORS":         "WM",
+}
+
+// cityAliases common short forms of city names
+var cityAliases = map[string]string{
+	"FT LAUDERDALE":     "FORT LAUDERDALE",
+	"FORT LAUD":         "FORT LAUDERDALE",
+	"HALLANDALE":        "HALLANDALE BEACH",
+	"DANIA":             "DANIA BEACH",
+	"LAUD BY THE SEA":   "LAUDERDALE BY THE SEA",
+	"LAUDERDALE BY SEA": "LAUDERDALE BY THE SEA",
+	"POMPANO":           "POMPANO BEACH",
+	"DEERFIELD":         "DEERFIELD BEACH",
+	"FT LAUD":           "FORT LAUDERDALE",
+	"NORTH LAUD":        "NORTH LAUDERDALE",
+	"N LAUDERDALE":      "NORTH LAUDERDALE",
+}
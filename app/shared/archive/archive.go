@@ -0,0 +1,236 @@
+package archive
+
+import (
+	"app/shared/fetch"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subjects of lookups without a folio of their own
+const (
+	SubjectUnresolved = "unresolved"
+	SubjectSearch     = "search"
+)
+
+// ManifestName the blob describing an archived lookup
+const ManifestName = "manifest.json"
+
+// stampLayout the fetch time part of a key, sorts in time order and needs no escaping
+const stampLayout = "20060102T150405.000000000Z"
+
+// Manifest what an archived lookup was and which pages it fetched
+type Manifest struct {
+	Key string `json:"key"`
+	// Lookup the kind of lookup, folio, address or owner
+	Lookup string `json:"lookup"`
+	// Input the lookup parameters, enough to run it again
+	Input map[string]string `json:"input"`
+	// BaseURL the site the lookup ran against, the links on the pages resolve against it
+	BaseURL        string    `json:"baseURL"`
+	Subject        string    `json:"subject"`
+	StartedAt      time.Time `json:"startedAt"`
+	ParserVersion  string    `json:"parserVersion"`
+	ProfileVersion string    `json:"profileVersion"`
+	// Error the lookup failed with, if it did
+	Error string `json:"error,omitempty"`
+	Pages []Page `json:"pages"`
+}
+
+// Page one archived page
+type Page struct {
+	// Name the blob the body is under, the fixture name of the request
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	SHA256    string    `json:"sha256"`
+}
+
+// Recorder wraps a fetcher for one lookup and keeps every page it fetches until they're saved. Each page is
+// archived under the lookup's key with the name Fixtures would look it up by, next to a manifest.json
+type Recorder struct {
+	Fetcher   fetch.Fetcher
+	StartedAt time.Time
+
+	mu    sync.Mutex
+	names []string
+	pages map[string]*fetch.Page
+}
+
+// NewRecorder start recording a lookup
+func NewRecorder(f fetch.Fetcher) *Recorder {
+	return &Recorder{Fetcher: f, StartedAt: time.Now().UTC(), pages: map[string]*fetch.Page{}}
+}
+
+// Get fetch the page and keep it
+func (r *Recorder) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+	page, err := r.Fetcher.Get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	r.keep(fetch.FixtureName(rawURL, nil), page)
+	return page, nil
+}
+
+// Submit submit the form and keep the response
+func (r *Recorder) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*fetch.Page, error) {
+	page, err := r.Fetcher.Submit(ctx, formURL, selector, values)
+	if err != nil {
+		return nil, err
+	}
+	r.keep(fetch.FixtureName(formURL, values), page)
+	return page, nil
+}
+
+func (r *Recorder) keep(name string, page *fetch.Page) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pages[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.pages[name] = page
+}
+
+// Key the archive prefix of a lookup of subject started at t. The subject is the folio the lookup resolved,
+// unresolved or search for the ones without a folio, so every fetch of a parcel sits together in time order
+func Key(subject string, t time.Time) string {
+	return subject + "/" + t.UTC().Format(stampLayout)
+}
+
+// Save write the recorded pages and the manifest under the subject, returning the key they went under
+func (r *Recorder) Save(ctx context.Context, store Store, subject string, m Manifest) (string, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if subject == "" {
+		subject = SubjectUnresolved
+	}
+
+	m.Subject, m.StartedAt = subject, r.StartedAt
+	m.Key = Key(subject, r.StartedAt)
+	m.Pages = []Page{}
+
+	for _, name := range r.names {
+		page := r.pages[name]
+
+		if err := store.Put(ctx, m.Key+"/"+name, page.Body); err != nil {
+			return m.Key, err
+		}
+
+		m.Pages = append(m.Pages, Page{Name: name, URL: page.URL, FetchedAt: page.FetchedAt, SHA256: page.SHA256()})
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m.Key, err
+	}
+
+	return m.Key, store.Put(ctx, m.Key+"/"+ManifestName, b)
+}
+
+// Lookups the keys of the archived lookups of a subject, oldest first
+func Lookups(ctx context.Context, store Store, subject string) ([]string, error) {
+
+	blobs, err := store.List(ctx, strings.TrimSuffix(subject, "/")+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, b := range blobs {
+		if path.Base(b) == ManifestName {
+			keys = append(keys, path.Dir(b))
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Resolve the key of an archived lookup: a full key as is, a bare folio or subject to its latest lookup
+func Resolve(ctx context.Context, store Store, key string) (string, error) {
+
+	key = strings.Trim(key, "/")
+
+	if strings.Contains(key, "/") {
+		return key, nil
+	}
+
+	keys, err := Lookups(ctx, store, key)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no archived lookups of %s: %w", key, ErrNotArchived)
+	}
+
+	return keys[len(keys)-1], nil
+}
+
+// ReadManifest read the manifest of an archived lookup
+func ReadManifest(ctx context.Context, store Store, key string) (Manifest, error) {
+
+	m := Manifest{}
+
+	b, err := store.Get(ctx, key+"/"+ManifestName)
+	if err != nil {
+		return m, err
+	}
+
+	return m, json.Unmarshal(b, &m)
+}
+
+// Replayer a fetcher answering from an archived lookup, only the pages the lookup fetched are there
+type Replayer struct {
+	Store Store
+	Key   string
+	// Manifest the archived lookup, the pages keep the time they were first fetched
+	Manifest Manifest
+}
+
+// NewReplayer a fetcher over the archived lookup under key
+func NewReplayer(ctx context.Context, store Store, key string) (*Replayer, error) {
+
+	m, err := ReadManifest(ctx, store, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Replayer{Store: store, Key: key, Manifest: m}, nil
+}
+
+// Get read the archived page for the URL
+func (r *Replayer) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+	return r.read(ctx, rawURL, fetch.FixtureName(rawURL, nil))
+}
+
+// Submit read the archived response to the form submission
+func (r *Replayer) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*fetch.Page, error) {
+	return r.read(ctx, formURL, fetch.FixtureName(formURL, values))
+}
+
+func (r *Replayer) read(ctx context.Context, rawURL string, name string) (*fetch.Page, error) {
+
+	body, err := r.Store.Get(ctx, r.Key+"/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("%s was not fetched by the archived lookup: %w", rawURL, err)
+	}
+
+	page := &fetch.Page{URL: rawURL, Body: body}
+	for _, p := range r.Manifest.Pages {
+		if p.Name == name {
+			page.URL, page.FetchedAt = p.URL, p.FetchedAt
+		}
+	}
+
+	return page, nil
+}
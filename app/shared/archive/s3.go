@@ -0,0 +1,294 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 archives to an S3 compatible bucket over its REST API, requests are signed with AWS Signature Version 4.
+// Objects are addressed path style so MinIO and the like work as well as AWS
+type S3 struct {
+	// Endpoint the service URL, https://s3.<region>.amazonaws.com for AWS
+	Endpoint string
+	Bucket   string
+	// Prefix put in front of every key, optional
+	Prefix string
+	Region string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken of temporary credentials like the ones Lambda gets, optional
+	SessionToken string
+
+	Client *http.Client
+}
+
+// DefaultS3Timeout how long a request to S3 may take, archiving must never hold up a lookup for long
+const DefaultS3Timeout = 10 * time.Second
+
+// NewS3FromEnv a store for bucket/prefix using the credentials and region of the standard AWS environment
+// variables. BCPA_S3_ENDPOINT points it at an S3 compatible service instead of AWS
+func NewS3FromEnv(bucketPrefix string) (*S3, error) {
+
+	parts := strings.SplitN(bucketPrefix, "/", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("invalid S3 archive %q, expected s3://bucket/prefix", "s3://"+bucketPrefix)
+	}
+
+	s := &S3{
+		Bucket:          parts[0],
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("BCPA_S3_ENDPOINT"),
+		Client:          &http.Client{Timeout: DefaultS3Timeout},
+	}
+
+	if len(parts) == 2 {
+		s.Prefix = strings.Trim(parts[1], "/")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 archive needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	return s, nil
+}
+
+// objectURL the path style URL of a key
+func (s *S3) objectURL(key string) string {
+
+	if s.Prefix != "" {
+		key = s.Prefix + "/" + key
+	}
+
+	return strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket + "/" + escapePath(key)
+}
+
+// do sign and send a request, anything but a 2xx is an error
+func (s *S3) do(ctx context.Context, method string, rawURL string, body []byte) ([]byte, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	Sign(req, body, s.Region, s.AccessKeyID, s.SecretAccessKey, s.SessionToken, time.Now())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, ErrNotArchived
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("S3 %s %s returned %s: %s", method, rawURL, resp.Status, bytes.TrimSpace(b))
+	}
+
+	return b, nil
+}
+
+// Put upload the object
+func (s *S3) Put(ctx context.Context, key string, body []byte) error {
+	_, err := s.do(ctx, http.MethodPut, s.objectURL(key), body)
+	return err
+}
+
+// Get download the object
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+
+	b, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err == ErrNotArchived {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotArchived)
+	}
+
+	return b, err
+}
+
+// listResult the part of the ListObjectsV2 answer we use
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List page through ListObjectsV2 for the keys under prefix
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+
+	full := prefix
+	if s.Prefix != "" {
+		full = s.Prefix + "/" + prefix
+	}
+
+	keys := []string{}
+	token := ""
+
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {full}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		b, err := s.do(ctx, http.MethodGet, strings.TrimRight(s.Endpoint, "/")+"/"+s.Bucket+"?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result := listResult{}
+		if err = xml.Unmarshal(b, &result); err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			if s.Prefix != "" {
+				c.Key = strings.TrimPrefix(c.Key, s.Prefix+"/")
+			}
+			keys = append(keys, c.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Sign add the AWS Signature Version 4 headers for S3 to a request
+func Sign(req *http.Request, body []byte, region string, accessKeyID string, secretAccessKey string, sessionToken string, now time.Time) {
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := hexSHA256(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	//The headers signed, lower case and sorted
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(req.Header.Get(k))
+		}
+	}
+
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery the query sorted by key with the SigV4 escaping
+func canonicalQuery(q url.Values) string {
+
+	keys := []string{}
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, escape(k)+"="+escape(v))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// escape URI encode everything but the unreserved characters, the way SigV4 wants it
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// escapePath escape each segment of a key, keeping the slashes
+func escapePath(key string) string {
+
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = escape(s)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,133 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotArchived returned by a store for a key it doesn't hold
+var ErrNotArchived = errors.New("not in the archive")
+
+// Store a blob store the raw pages are archived to, keys are slash separated paths
+type Store interface {
+	// Put write the blob under the key, replacing any blob already there
+	Put(ctx context.Context, key string, body []byte) error
+	// Get read the blob under the key, ErrNotArchived when there's none
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List the keys starting with prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Open the store a spec names: s3://bucket/prefix for an S3 compatible bucket, a directory otherwise.
+// An empty spec is no store at all
+func Open(spec string) (Store, error) {
+
+	switch {
+	case spec == "":
+		return nil, nil
+	case strings.HasPrefix(spec, "s3://"):
+		return NewS3FromEnv(strings.TrimPrefix(spec, "s3://"))
+	}
+
+	return NewDir(strings.TrimPrefix(spec, "file://")), nil
+}
+
+// Dir archives to a local directory, each key is a file under it
+type Dir struct {
+	Root string
+}
+
+// NewDir a store writing under root
+func NewDir(root string) *Dir {
+	return &Dir{Root: root}
+}
+
+// path the file of a key, keys can't climb out of the root
+func (d *Dir) path(key string) (string, error) {
+
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid archive key %q", key)
+	}
+
+	return filepath.Join(d.Root, filepath.FromSlash(clean)), nil
+}
+
+// Put write the blob to its file
+func (d *Dir) Put(ctx context.Context, key string, body []byte) error {
+
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(name, body, 0644)
+}
+
+// Get read the blob from its file
+func (d *Dir) Get(ctx context.Context, key string) ([]byte, error) {
+
+	name, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotArchived)
+	}
+
+	return body, err
+}
+
+// List walk the directory the prefix is in for the files under it
+func (d *Dir) List(ctx context.Context, prefix string) ([]string, error) {
+
+	keys := []string{}
+
+	//Only the directory the prefix ends in, "a/b" may match "a/bc" so it's "a" for that
+	start := d.Root
+	if dir := path.Dir(prefix + "x"); dir != "." {
+		var err error
+		if start, err = d.path(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	err := filepath.Walk(start, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.Root, name)
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+
+	sort.Strings(keys)
+
+	return keys, err
+}
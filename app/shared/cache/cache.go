@@ -0,0 +1,368 @@
+package cache
+
+import (
+	"app/shared/fetch"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sections of a parcel cached, each with a time to live of its own
+const (
+	SectionParcel = "parcel"
+	SectionCard   = "card"
+	SectionSketch = "sketch"
+	// SectionAddress the folio an address search landed on
+	SectionAddress = "address"
+)
+
+// TTLs how long the pages of each section are served from the cache, a section without one isn't cached
+type TTLs map[string]time.Duration
+
+// DefaultTTLs the assessments and buildings change about once a year, owners and sales on the parcel page more often
+var DefaultTTLs = TTLs{
+	SectionParcel:  24 * time.Hour,
+	SectionCard:    30 * 24 * time.Hour,
+	SectionSketch:  30 * 24 * time.Hour,
+	SectionAddress: 30 * 24 * time.Hour,
+}
+
+// ParseTTLs read TTLs like "parcel=12h,card=720h" over the defaults, a TTL of 0 stops caching the section
+func ParseTTLs(s string) (TTLs, error) {
+
+	ttls := TTLs{}
+	for k, v := range DefaultTTLs {
+		ttls[k] = v
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if _, ok := DefaultTTLs[parts[0]]; !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid cache TTL %q, expected section=duration for parcel, card, sketch or address", pair)
+		}
+
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid cache TTL %q, expected a duration like 12h", pair)
+		}
+
+		ttls[parts[0]] = d
+	}
+
+	return ttls, nil
+}
+
+// Control how a request wants the cache used, Cache-Control style
+type Control struct {
+	// NoCache fetch the pages again instead of reading them from the cache, the fresh pages are still kept
+	NoCache bool
+	// NoStore neither read nor keep
+	NoStore bool
+	// MaxAge accept cached pages up to this old, it can only shorten the section TTLs
+	MaxAge *time.Duration
+}
+
+// ParseControl read the comma separated no-cache, no-store and max-age=<seconds> directives
+func ParseControl(s string) (Control, error) {
+
+	c := Control{}
+
+	for _, d := range strings.Split(s, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+
+		switch {
+		case d == "":
+		case d == "no-cache":
+			c.NoCache = true
+		case d == "no-store":
+			c.NoStore = true
+		case strings.HasPrefix(d, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(d, "max-age="))
+			if err != nil || seconds < 0 {
+				return Control{}, fmt.Errorf("invalid cache directive %q, max-age takes seconds", d)
+			}
+			maxAge := time.Duration(seconds) * time.Second
+			c.MaxAge = &maxAge
+		default:
+			return Control{}, fmt.Errorf("invalid cache directive %q, expected no-cache, no-store or max-age=<seconds>", d)
+		}
+	}
+
+	return c, nil
+}
+
+// Cache keeps the parcel, card and sketch pages keyed by folio and tax year
+type Cache struct {
+	Store Store
+	TTLs  TTLs
+	// Now the clock entries are aged by, tests move it
+	Now func() time.Time
+}
+
+// New a cache over the store
+func New(store Store, ttls TTLs) *Cache {
+	return &Cache{Store: store, TTLs: ttls, Now: time.Now}
+}
+
+// TaxYear the tax roll a page without a tax year of its own belongs to, the year it's fetched in.
+// The keys change with the roll so a new year's values are never answered from last year's pages
+func TaxYear(t time.Time) string {
+	return strconv.Itoa(t.Year())
+}
+
+var folioPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Key the section and cache key of a page, <folio>/<tax year>/<page>. False for the pages that aren't cached
+func Key(rawURL string, now time.Time) (string, string, bool) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false
+	}
+
+	q := u.Query()
+
+	taxYear := q.Get("taxyear")
+	if taxYear == "" {
+		taxYear = TaxYear(now)
+	}
+
+	switch path.Base(u.Path) {
+	case "RecInfo.asp":
+		if folio := q.Get("URL_Folio"); folioPattern.MatchString(folio) {
+			return SectionParcel, folio + "/" + TaxYear(now) + "/parcel", true
+		}
+	case "RecBuildingCard.asp":
+		if folio := q.Get("folio"); folioPattern.MatchString(folio) {
+			return SectionCard, folio + "/" + taxYear + "/card-" + q.Get("cardno"), true
+		}
+	case "RecPatriotSketch.asp":
+		if folio := q.Get("folio"); folioPattern.MatchString(folio) {
+			return SectionSketch, folio + "/" + taxYear + "/sketch-" + q.Get("card"), true
+		}
+	}
+
+	return "", "", false
+}
+
+// AddressKey the key of the folio an address search landed on, the same address in any letter case or order
+func AddressKey(input map[string]string) string {
+
+	pairs := []string{}
+	for k, v := range input {
+		pairs = append(pairs, k+"="+strings.ToUpper(strings.Join(strings.Fields(v), " ")))
+	}
+	sort.Strings(pairs)
+
+	sum := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+
+	return SectionAddress + "/" + hex.EncodeToString(sum[:])
+}
+
+// get the entry under the key when it's fresh enough for the section and the request
+func (c *Cache) get(section string, key string, ctl Control) (Entry, bool) {
+
+	ttl := c.TTLs[section]
+	if ctl.MaxAge != nil && *ctl.MaxAge < ttl {
+		ttl = *ctl.MaxAge
+	}
+	if ttl <= 0 || ctl.NoCache || ctl.NoStore {
+		return Entry{}, false
+	}
+
+	e, ok, err := c.Store.Get(key)
+	if err != nil {
+		log.Printf("reading cache entry %s failed: %v", key, err)
+		return Entry{}, false
+	}
+
+	if !ok || c.Now().Sub(e.FetchedAt) >= ttl {
+		return Entry{}, false
+	}
+
+	return e, true
+}
+
+// put keep the entry unless the section isn't cached or the request said not to. Caching is best effort,
+// a store that fails is logged and the lookup goes on
+func (c *Cache) put(section string, key string, e Entry, ctl Control) {
+
+	if c.TTLs[section] <= 0 || ctl.NoStore {
+		return
+	}
+
+	if err := c.Store.Put(key, e); err != nil {
+		log.Printf("writing cache entry %s failed: %v", key, err)
+	}
+}
+
+// Folio the folio an address search landed on before
+func (c *Cache) Folio(input map[string]string, ctl Control) (string, bool) {
+
+	e, ok := c.get(SectionAddress, AddressKey(input), ctl)
+	if !ok {
+		return "", false
+	}
+
+	return string(e.Body), true
+}
+
+// KeepFolio remember the folio an address search landed on
+func (c *Cache) KeepFolio(input map[string]string, folio string, ctl Control) {
+	c.put(SectionAddress, AddressKey(input), Entry{Body: []byte(folio), FetchedAt: c.Now()}, ctl)
+}
+
+// Keep cache a page fetched some other way under the key of rawURL, like the parcel page an address search lands on
+func (c *Cache) Keep(rawURL string, page *fetch.Page, ctl Control) {
+	if section, key, ok := Key(rawURL, c.Now()); ok {
+		c.put(section, key, Entry{URL: page.URL, Body: page.Body, FetchedAt: page.FetchedAt}, ctl)
+	}
+}
+
+// Status what a lookup was served from the cache
+type Status struct {
+	// Hits pages read from the cache
+	Hits int
+	// Misses pages fetched from BCPA
+	Misses int
+	// Oldest fetch time of the oldest page read from the cache
+	Oldest time.Time
+}
+
+// String HIT when every page came from the cache, MISS when none did and PARTIAL in between
+func (s Status) String() string {
+	switch {
+	case s.Hits > 0 && s.Misses == 0:
+		return "HIT"
+	case s.Hits > 0:
+		return "PARTIAL"
+	}
+	return "MISS"
+}
+
+// Age how old the oldest cached page is
+func (s Status) Age(now time.Time) time.Duration {
+	if s.Oldest.IsZero() {
+		return 0
+	}
+	return now.Sub(s.Oldest)
+}
+
+// Fetcher answers the pages of one lookup from the cache and fetches the ones it doesn't have. A fetched page is
+// only cached once the lookup has checked it parses, see Keep
+type Fetcher struct {
+	Cache   *Cache
+	Fetcher fetch.Fetcher
+	Control Control
+
+	mu      sync.Mutex
+	status  Status
+	fetched map[string]pending
+}
+
+// pending a fetched page waiting for the lookup to vouch for it, by the URL it was fetched from
+type pending struct {
+	section string
+	key     string
+	entry   Entry
+}
+
+// Fetcher a fetcher for one lookup over f, used as the request's control says
+func (c *Cache) Fetcher(f fetch.Fetcher, ctl Control) *Fetcher {
+	return &Fetcher{Cache: c, Fetcher: f, Control: ctl}
+}
+
+// Get the cached page when it's fresh, fetch it otherwise
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+
+	section, key, ok := Key(rawURL, f.Cache.Now())
+	if !ok {
+		return f.Fetcher.Get(ctx, rawURL)
+	}
+
+	if e, ok := f.Cache.get(section, key, f.Control); ok {
+		f.count(true, e.FetchedAt)
+		return &fetch.Page{URL: e.URL, Body: e.Body, FetchedAt: e.FetchedAt}, nil
+	}
+
+	page, err := f.Fetcher.Get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	f.count(false, time.Time{})
+
+	f.mu.Lock()
+	if f.fetched == nil {
+		f.fetched = map[string]pending{}
+	}
+	f.fetched[page.URL] = pending{section, key, Entry{URL: page.URL, Body: page.Body, FetchedAt: page.FetchedAt}}
+	f.mu.Unlock()
+
+	return page, nil
+}
+
+// Keep cache the pages fetched from these URLs, the ones that parsed. An error page, an empty one or a layout
+// that no longer parses is left out so the next lookup fetches it again instead of being served it for the TTL
+func (f *Fetcher) Keep(urls ...string) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range urls {
+		if p, ok := f.fetched[u]; ok {
+			f.Cache.put(p.section, p.key, p.entry, f.Control)
+			delete(f.fetched, u)
+		}
+	}
+}
+
+// Submit always goes to BCPA, the search results aren't cached
+func (f *Fetcher) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*fetch.Page, error) {
+
+	page, err := f.Fetcher.Submit(ctx, formURL, selector, values)
+	if err != nil {
+		return nil, err
+	}
+	f.count(false, time.Time{})
+
+	return page, nil
+}
+
+func (f *Fetcher) count(hit bool, fetchedAt time.Time) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !hit {
+		f.status.Misses++
+		return
+	}
+
+	f.status.Hits++
+	if f.status.Oldest.IsZero() || fetchedAt.Before(f.status.Oldest) {
+		f.status.Oldest = fetchedAt
+	}
+}
+
+// Status what the lookup was served from the cache so far
+func (f *Fetcher) Status() Status {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.status
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"app/shared/fetch"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fixtures = filepath.Join("..", "..", "..", "testdata", "bcpa")
+
+const (
+	parcelURL = "http://www.bcpa.net/RecInfo.asp?URL_Folio=504203060330"
+	cardURL   = "http://www.bcpa.net/RecBuildingCard.asp?folio=504203060330&taxyear=2018&cardno=1"
+	sketchURL = "http://www.bcpa.net/RecPatriotSketch.asp?folio=504203060330&taxyear=2018&card=1"
+)
+
+func TestKey(t *testing.T) {
+
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for rawURL, want := range map[string][2]string{
+		parcelURL: {SectionParcel, "504203060330/2019/parcel"},
+		cardURL:   {SectionCard, "504203060330/2018/card-1"},
+		sketchURL: {SectionSketch, "504203060330/2018/sketch-1"},
+	} {
+		section, key, ok := Key(rawURL, now)
+		assert.True(t, ok, rawURL)
+		assert.Equal(t, want, [2]string{section, key})
+	}
+
+	for _, rawURL := range []string{"http://www.bcpa.net/RecAddr.asp", "http://www.bcpa.net/RecInfo.asp?URL_Folio=../../etc"} {
+		_, _, ok := Key(rawURL, now)
+		assert.False(t, ok, rawURL)
+	}
+
+	//The same address however it was typed
+	assert.Equal(t, AddressKey(map[string]string{"SN": "2500", "HN": "OCEAN"}), AddressKey(map[string]string{"HN": " ocean ", "SN": "2500"}))
+}
+
+func TestParseTTLs(t *testing.T) {
+
+	ttls, err := ParseTTLs("parcel=12h, sketch=0")
+	assert.Nil(t, err)
+	assert.Equal(t, 12*time.Hour, ttls[SectionParcel])
+	assert.Equal(t, time.Duration(0), ttls[SectionSketch])
+	assert.Equal(t, DefaultTTLs[SectionCard], ttls[SectionCard])
+
+	for _, s := range []string{"owner=1h", "parcel", "parcel=tomorrow", "card=-1h"} {
+		_, err = ParseTTLs(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestParseControl(t *testing.T) {
+
+	c, err := ParseControl("no-cache")
+	assert.Nil(t, err)
+	assert.True(t, c.NoCache)
+
+	c, err = ParseControl("max-age=60, no-store")
+	assert.Nil(t, err)
+	assert.True(t, c.NoStore)
+	if assert.NotNil(t, c.MaxAge) {
+		assert.Equal(t, time.Minute, *c.MaxAge)
+	}
+
+	for _, s := range []string{"max-age=soon", "max-age=-1", "public"} {
+		_, err = ParseControl(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestFetcher(t *testing.T) {
+
+	now := time.Now()
+	c := New(NewMemory(0), DefaultTTLs)
+	c.Now = func() time.Time { return now }
+
+	get := func(ctl Control, rawURL string) Status {
+		f := c.Fetcher(fetch.NewFixtures(fixtures), ctl)
+		page, err := f.Get(context.Background(), rawURL)
+		assert.Nil(t, err)
+		f.Keep(page.URL)
+		return f.Status()
+	}
+
+	//Nothing is cached until the lookup keeps it
+	f := c.Fetcher(fetch.NewFixtures(fixtures), Control{})
+	_, err := f.Get(context.Background(), parcelURL)
+	assert.Nil(t, err)
+	_, ok, _ := c.Store.Get("504203060330/" + TaxYear(now) + "/parcel")
+	assert.False(t, ok)
+
+	assert.Equal(t, "MISS", get(Control{}, parcelURL).String())
+	assert.Equal(t, "HIT", get(Control{}, parcelURL).String())
+	assert.Equal(t, "MISS", get(Control{NoCache: true}, parcelURL).String())
+
+	//A day on the parcel page is stale, the card isn't
+	get(Control{}, cardURL)
+	now = now.Add(25 * time.Hour)
+
+	assert.Equal(t, "MISS", get(Control{}, parcelURL).String())
+
+	status := get(Control{}, cardURL)
+	assert.Equal(t, "HIT", status.String())
+	assert.Equal(t, 25*time.Hour, status.Age(now).Round(time.Hour))
+
+	//Unless the request wants younger pages
+	hour := time.Hour
+	assert.Equal(t, "MISS", get(Control{MaxAge: &hour}, cardURL).String())
+}
+
+func TestMemoryEviction(t *testing.T) {
+
+	m := NewMemory(2)
+	start := time.Now()
+
+	for i, key := range []string{"a", "b", "c"} {
+		assert.Nil(t, m.Put(key, Entry{FetchedAt: start.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	_, ok, _ := m.Get("a")
+	assert.False(t, ok)
+	_, ok, _ = m.Get("c")
+	assert.True(t, ok)
+}
+
+func TestDisk(t *testing.T) {
+
+	d := NewDisk(t.TempDir())
+	e := Entry{URL: parcelURL, Body: []byte("<html>"), FetchedAt: time.Now().UTC().Round(time.Second)}
+
+	assert.Nil(t, d.Put("504203060330/2019/parcel", e))
+
+	got, ok, err := d.Get("504203060330/2019/parcel")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, e, got)
+
+	_, ok, err = d.Get("504203060330/2019/card-1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
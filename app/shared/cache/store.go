@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry a cached page
+type Entry struct {
+	URL       string    `json:"url"`
+	Body      []byte    `json:"body"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// Store where the cached pages are kept, keys are slash separated paths
+type Store interface {
+	// Get the entry under the key, false when there's none
+	Get(key string) (Entry, bool, error)
+	// Put write the entry under the key, replacing any entry already there
+	Put(key string, e Entry) error
+}
+
+// Open the store a spec names: memory for one in the process, a directory otherwise. An empty spec is no cache at all
+func Open(spec string) (Store, error) {
+
+	switch spec {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemory(DefaultMaxEntries), nil
+	}
+
+	return NewDisk(strings.TrimPrefix(spec, "file://")), nil
+}
+
+// DefaultMaxEntries about a thousand parcels with their cards and sketch
+const DefaultMaxEntries = 5000
+
+// Memory keeps the entries in the process, a warm Lambda container or the HTTP server reuses them
+type Memory struct {
+	// MaxEntries the oldest entry is dropped to make room past it, 0 for no limit
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// NewMemory an empty in-process store
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{MaxEntries: maxEntries, entries: map[string]Entry{}}
+}
+
+// Get the entry under the key
+func (m *Memory) Get(key string) (Entry, bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	return e, ok, nil
+}
+
+// Put keep the entry, dropping the oldest one when full
+func (m *Memory) Put(key string, e Entry) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[key]; !ok && m.MaxEntries > 0 && len(m.entries) >= m.MaxEntries {
+		oldest := ""
+		for k, v := range m.entries {
+			if oldest == "" || v.FetchedAt.Before(m.entries[oldest].FetchedAt) {
+				oldest = k
+			}
+		}
+		delete(m.entries, oldest)
+	}
+
+	m.entries[key] = e
+	return nil
+}
+
+// Disk keeps each entry as a JSON file under a directory, shared by every process pointed at it
+type Disk struct {
+	Root string
+}
+
+// NewDisk a store writing under root
+func NewDisk(root string) *Disk {
+	return &Disk{Root: root}
+}
+
+// path the file of a key, keys can't climb out of the root
+func (d *Disk) path(key string) (string, error) {
+
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+
+	return filepath.Join(d.Root, filepath.FromSlash(clean)+".json"), nil
+}
+
+// Get read the entry from its file
+func (d *Disk) Get(key string) (Entry, bool, error) {
+
+	name, err := d.path(key)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	e := Entry{}
+	if err = json.Unmarshal(b, &e); err != nil {
+		return Entry{}, false, fmt.Errorf("cache entry %s: %w", key, err)
+	}
+
+	return e, true, nil
+}
+
+// Put write the entry to its file. It's written aside and renamed into place so a reader never sees half of it
+func (d *Disk) Put(key string, e Entry) error {
+
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".entry")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,223 @@
+package fetch
+
+import (
+	"app/shared/problem"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// ErrBreakerOpen the cause of the upstream unavailable error a lookup gets while the breaker is open
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// Breaker stops asking BCPA once it keeps failing, so a lookup answers upstream unavailable at once instead of
+// waiting on a site that's down. After Threshold failures in a row it opens for Cooldown, then lets one trial
+// request through: a success closes it, a failure opens it again
+type Breaker struct {
+	Fetcher Fetcher
+	// Threshold failures in a row that open the breaker
+	Threshold int
+	// Cooldown how long the breaker stays open before a trial request
+	Cooldown time.Duration
+	// Now the clock, tests move it
+	Now func() time.Time
+
+	mu          sync.Mutex
+	failures    int
+	openedAt    time.Time
+	trial       bool
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+// NewBreaker a breaker in front of f that opens after 5 failures in a row for 30s
+func NewBreaker(f Fetcher) *Breaker {
+	return &Breaker{Fetcher: f, Threshold: 5, Cooldown: 30 * time.Second, Now: time.Now}
+}
+
+// Configure set the breaker from a spec like "failures=3,cooldown=1m", the settings left out keep their value
+func (b *Breaker) Configure(spec string) error {
+
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid breaker setting %q, expected name=value", pair)
+		}
+
+		var err error
+		switch parts[0] {
+		case "failures":
+			b.Threshold, err = strconv.Atoi(parts[1])
+		case "cooldown":
+			b.Cooldown, err = time.ParseDuration(parts[1])
+		default:
+			return fmt.Errorf("unknown breaker setting %q, expected failures or cooldown", parts[0])
+		}
+
+		if err != nil || strings.HasPrefix(parts[1], "-") {
+			return fmt.Errorf("invalid breaker setting %q", pair)
+		}
+	}
+
+	return nil
+}
+
+// Get fetch the page unless the breaker is open
+func (b *Breaker) Get(ctx context.Context, rawURL string) (*Page, error) {
+
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	page, err := b.Fetcher.Get(ctx, rawURL)
+	b.done(ctx, err)
+
+	return page, err
+}
+
+// Submit submit the form unless the breaker is open
+func (b *Breaker) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*Page, error) {
+
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	page, err := b.Fetcher.Submit(ctx, formURL, selector, values)
+	b.done(ctx, err)
+
+	return page, err
+}
+
+// allow let the request through while closed, and the one trial request once the cooldown is over
+func (b *Breaker) allow() error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return nil
+	}
+
+	retryAt := b.openedAt.Add(b.Cooldown)
+	if b.Now().Before(retryAt) || b.trial {
+		return &problem.Error{
+			Code:   problem.CodeUpstreamUnavailable,
+			Detail: fmt.Sprintf("BCPA failed %d times in a row, last with %q, not asking again until %s", b.failures, b.lastError, retryAt.UTC().Format(time.RFC3339)),
+			Err:    ErrBreakerOpen,
+		}
+	}
+
+	b.trial = true
+	return nil
+}
+
+// done count the outcome of a request. Any answer from BCPA, a 404 as much as a 200, shows it's up.
+// A request the lookup gave up on says nothing either way, a trial one is let go for the next request to make
+func (b *Breaker) done(ctx context.Context, err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		b.trial = false
+		return
+	}
+
+	if !failed(err) {
+		if err == nil {
+			b.lastSuccess = b.Now()
+		}
+		if !b.openedAt.IsZero() {
+			log.Printf("BCPA answered again, closing the circuit breaker")
+		}
+		b.failures, b.openedAt, b.trial = 0, time.Time{}, false
+		return
+	}
+
+	b.failures++
+	b.lastFailure, b.lastError = b.Now(), err.Error()
+
+	if b.trial || (b.openedAt.IsZero() && b.failures >= b.Threshold) {
+		log.Printf("BCPA failed %d times in a row, opening the circuit breaker for %s: %v", b.failures, b.Cooldown, err)
+		b.openedAt, b.trial = b.Now(), false
+	}
+}
+
+// failed an error that says BCPA is down or struggling: a request that got no answer, timed out, or a 5xx or 429.
+// A 404, a form missing from the page or a page that doesn't parse is BCPA answering
+func failed(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500 || se.StatusCode == http.StatusTooManyRequests
+	}
+
+	//Dial, TLS and read failures and timeouts all come back as net errors, a body cut short as an unexpected EOF
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// BreakerState what the health endpoint reports about the breaker
+type BreakerState struct {
+	State string `json:"state"`
+	// Failures in a row since the last answer
+	Failures    int        `json:"failures"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	// RetryAt when an open breaker lets a trial request through
+	RetryAt *time.Time `json:"retryAt,omitempty"`
+}
+
+// State the breaker as it is now
+func (b *Breaker) State() BreakerState {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerState{State: BreakerClosed, Failures: b.failures, LastError: b.lastError}
+
+	if !b.lastSuccess.IsZero() {
+		t := b.lastSuccess
+		s.LastSuccess = &t
+	}
+	if !b.lastFailure.IsZero() {
+		t := b.lastFailure
+		s.LastFailure = &t
+	}
+
+	if !b.openedAt.IsZero() {
+		retryAt := b.openedAt.Add(b.Cooldown)
+		s.State, s.RetryAt = BreakerOpen, &retryAt
+		if b.trial || !b.Now().Before(retryAt) {
+			s.State = BreakerHalfOpen
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,141 @@
+package fetch
+
+import (
+	"app/shared/problem"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scripted answers with the next error in line, nil for a page
+type scripted struct {
+	errs  []error
+	calls int
+}
+
+func (s *scripted) Get(ctx context.Context, rawURL string) (*Page, error) {
+	err := s.errs[s.calls%len(s.errs)]
+	s.calls++
+	if err != nil {
+		return nil, err
+	}
+	return &Page{URL: rawURL}, nil
+}
+
+func (s *scripted) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*Page, error) {
+	return s.Get(ctx, formURL)
+}
+
+func TestBreaker(t *testing.T) {
+
+	down := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	s := &scripted{errs: []error{down}}
+
+	now := time.Now()
+	b := NewBreaker(s)
+	b.Threshold, b.Cooldown = 3, time.Minute
+	b.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := b.Get(context.Background(), "http://www.bcpa.net/RecAddr.asp")
+		assert.Equal(t, down, err)
+	}
+	assert.Equal(t, BreakerOpen, b.State().State)
+
+	//Open, BCPA isn't asked
+	_, err := b.Submit(context.Background(), "http://www.bcpa.net/RecAddr.asp", "form", nil)
+	assert.True(t, errors.Is(err, ErrBreakerOpen))
+	assert.Equal(t, problem.CodeUpstreamUnavailable, problem.CodeOf(err))
+	assert.Equal(t, 3, s.calls)
+
+	//After the cooldown one trial, it fails and the breaker opens again
+	now = now.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, b.State().State)
+
+	_, err = b.Get(context.Background(), "http://www.bcpa.net/RecAddr.asp")
+	assert.Equal(t, down, err)
+	assert.Equal(t, BreakerOpen, b.State().State)
+	assert.Equal(t, 4, s.calls)
+
+	//The next trial gets an answer and closes it
+	s.errs = []error{nil}
+	now = now.Add(time.Minute)
+
+	_, err = b.Get(context.Background(), "http://www.bcpa.net/RecAddr.asp")
+	assert.Nil(t, err)
+
+	state := b.State()
+	assert.Equal(t, BreakerClosed, state.State)
+	assert.Equal(t, 0, state.Failures)
+	if assert.NotNil(t, state.LastSuccess) {
+		assert.Equal(t, now, *state.LastSuccess)
+	}
+}
+
+func TestBreakerIgnoresMissingPages(t *testing.T) {
+
+	s := &scripted{errs: []error{&StatusError{URL: "http://www.bcpa.net/RecInfo.asp", Status: "404 Not Found", StatusCode: 404}}}
+	b := NewBreaker(s)
+	b.Threshold = 1
+
+	for i := 0; i < 3; i++ {
+		_, err := b.Get(context.Background(), "http://www.bcpa.net/RecInfo.asp")
+		assert.Equal(t, problem.CodeNotFound, problem.CodeOf(err))
+	}
+
+	assert.Equal(t, BreakerClosed, b.State().State)
+	assert.Equal(t, 3, s.calls)
+}
+
+func TestBreakerIgnoresPagesThatDontParse(t *testing.T) {
+
+	//BCPA answered, with a page the form or parser didn't expect
+	s := &scripted{errs: []error{errors.New("form not found"), fmt.Errorf("folio 504203060330: %w", errors.New("no parcel ID on the page"))}}
+	b := NewBreaker(s)
+	b.Threshold = 1
+
+	for i := 0; i < 4; i++ {
+		b.Submit(context.Background(), "http://www.bcpa.net/RecAddr.asp", "form", nil)
+	}
+
+	assert.Equal(t, BreakerClosed, b.State().State)
+	assert.Equal(t, 4, s.calls)
+
+	//A page missing from the saved ones isn't an outage either
+	s = &scripted{errs: []error{&MissingFixtureError{Name: "RecInfo.asp.html", URL: "http://www.bcpa.net/RecInfo.asp"}}}
+	b = NewBreaker(s)
+	b.Threshold = 1
+	b.Get(context.Background(), "http://www.bcpa.net/RecInfo.asp")
+	assert.Equal(t, BreakerClosed, b.State().State)
+
+	//Transport errors, timeouts, 5xx and 429 answers do count
+	for _, err := range []error{
+		&url.Error{Op: "Get", URL: "http://www.bcpa.net/RecInfo.asp", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}},
+		context.DeadlineExceeded,
+		&StatusError{StatusCode: 503, Status: "503 Service Unavailable"},
+		&StatusError{StatusCode: 429, Status: "429 Too Many Requests"},
+	} {
+		b := NewBreaker(&scripted{errs: []error{err}})
+		b.Threshold = 1
+		b.Get(context.Background(), "http://www.bcpa.net/RecInfo.asp")
+		assert.Equal(t, BreakerOpen, b.State().State, err.Error())
+	}
+}
+
+func TestBreakerConfigure(t *testing.T) {
+
+	b := NewBreaker(nil)
+	assert.Nil(t, b.Configure("failures=2, cooldown=1m"))
+	assert.Equal(t, 2, b.Threshold)
+	assert.Equal(t, time.Minute, b.Cooldown)
+
+	for _, spec := range []string{"failures", "failures=-1", "cooldown=later", "threshold=3"} {
+		assert.NotNil(t, b.Configure(spec), spec)
+	}
+}
@@ -0,0 +1,65 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Page an upstream HTML page as it was fetched
+type Page struct {
+	URL       string    `json:"url"`
+	Body      []byte    `json:"-"`
+	FetchedAt time.Time `json:"fetchedat"`
+}
+
+// SHA256 hex digest of the page body as fetched
+func (p *Page) SHA256() string {
+	sum := sha256.Sum256(p.Body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Document parse the page body
+func (p *Page) Document() (*goquery.Document, error) {
+	return goquery.NewDocumentFromReader(bytes.NewReader(p.Body))
+}
+
+// Fetcher retrieves BCPA pages, from the live site or from saved HTML. A fetch stops when its context is done
+type Fetcher interface {
+	// Get fetch the page at the URL
+	Get(ctx context.Context, rawURL string) (*Page, error)
+	// Submit open the page at formURL, fill the form matched by selector with the values and submit it
+	Submit(ctx context.Context, formURL string, selector string, values url.Values) (*Page, error)
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FixtureName file name a page is saved under. The host is dropped and the query is sorted so the
+// same page always maps to the same file
+func FixtureName(rawURL string, values url.Values) string {
+
+	name := rawURL
+	q := url.Values{}
+
+	if u, err := url.Parse(rawURL); err == nil {
+		name = path.Base(u.Path)
+		q = u.Query()
+	}
+
+	for k, v := range values {
+		q[k] = v
+	}
+
+	if len(q) > 0 {
+		name += "_" + q.Encode()
+	}
+
+	return unsafeChars.ReplaceAllString(name, "_") + ".html"
+}
@@ -0,0 +1,90 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Fixtures serves saved BCPA HTML from a directory, each page is looked up by its FixtureName
+type Fixtures struct {
+	Dir string
+}
+
+// NewFixtures create a fetcher backed by the HTML files in dir
+func NewFixtures(dir string) *Fixtures {
+	return &Fixtures{Dir: dir}
+}
+
+// Get read the saved page for the URL
+func (f *Fixtures) Get(ctx context.Context, rawURL string) (*Page, error) {
+	return f.read(ctx, rawURL, FixtureName(rawURL, nil))
+}
+
+// Submit read the saved response to the form submission
+func (f *Fixtures) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*Page, error) {
+	return f.read(ctx, formURL, FixtureName(formURL, values))
+}
+
+func (f *Fixtures) read(ctx context.Context, rawURL string, name string) (*Page, error) {
+
+	//Like the live site, nothing is fetched for a lookup that gave up
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(f.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, &MissingFixtureError{Name: name, URL: rawURL}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{URL: rawURL, Body: body, FetchedAt: time.Now()}, nil
+}
+
+// MissingFixtureError a page with no saved HTML
+type MissingFixtureError struct {
+	Name string
+	URL  string
+}
+
+func (e *MissingFixtureError) Error() string {
+	return fmt.Sprintf("no fixture %s for %s", e.Name, e.URL)
+}
+
+// Recorder wraps a fetcher and saves every page it fetches so it can be replayed with Fixtures
+type Recorder struct {
+	Fetcher Fetcher
+	Dir     string
+}
+
+// Get fetch the page and save it
+func (r *Recorder) Get(ctx context.Context, rawURL string) (*Page, error) {
+	page, err := r.Fetcher.Get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return page, r.save(FixtureName(rawURL, nil), page)
+}
+
+// Submit submit the form and save the response
+func (r *Recorder) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*Page, error) {
+	page, err := r.Fetcher.Submit(ctx, formURL, selector, values)
+	if err != nil {
+		return nil, err
+	}
+	return page, r.save(FixtureName(formURL, values), page)
+}
+
+func (r *Recorder) save(name string, page *Page) error {
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(r.Dir, name), page.Body, 0644)
+}
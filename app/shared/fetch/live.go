@@ -0,0 +1,122 @@
+package fetch
+
+import (
+	"app/shared/problem"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/headzoo/surf.v1"
+)
+
+// StatusError an answer from BCPA other than 200 OK
+type StatusError struct {
+	URL        string
+	Status     string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.URL, e.Status)
+}
+
+// Unwrap carries the not found catalogue code for a page BCPA doesn't have, other statuses are upstream failures
+func (e *StatusError) Unwrap() error {
+
+	if e.StatusCode == http.StatusNotFound {
+		return problem.New(problem.CodeNotFound, e.Error())
+	}
+
+	return nil
+}
+
+// Live fetches pages from the live BCPA site, forms are driven with a surf browser on the same transport
+type Live struct {
+	Client *http.Client
+}
+
+// NewLive create a live fetcher going through a polite transport of its own with the default budget
+func NewLive() *Live {
+	return NewLiveThrough(NewPolite())
+}
+
+// NewLiveThrough create a live fetcher whose requests, form submits included, go through the transport
+func NewLiveThrough(t http.RoundTripper) *Live {
+	return &Live{Client: &http.Client{Transport: t}}
+}
+
+// Get fetch the page at the URL
+func (l *Live) Get(ctx context.Context, rawURL string) (*Page, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: rawURL, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{URL: rawURL, Body: body, FetchedAt: time.Now()}, nil
+}
+
+// Submit open the page at formURL, fill the form matched by selector with the values and submit it
+func (l *Live) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*Page, error) {
+
+	t := l.Client.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+
+	bow := surf.NewBrowser()
+	bow.SetTransport(&contextTransport{ctx: ctx, next: t})
+
+	//Ensure no error opening page
+	if err := bow.Open(formURL); err != nil {
+		return nil, fmt.Errorf("%w - Error while opening: %s", err, formURL)
+	}
+
+	fm, err := bow.Form(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	//Text inputs and dropdowns are filled differently
+	for name := range values {
+		if fm.Input(name, values.Get(name)) != nil {
+			if err = fm.SelectByOptionValue(name, values.Get(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = fm.Submit(); err != nil {
+		return nil, err
+	}
+
+	return &Page{URL: bow.Url().String(), Body: []byte(bow.Body()), FetchedAt: time.Now()}, nil
+}
+
+// contextTransport ties the requests of a surf browser to the lookup's context, surf has no way to pass one
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,289 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent says who's asking so BCPA can tell the lookups apart from a browser
+const DefaultUserAgent = "bcpa-lookup/1.0"
+
+// Polite the transport every request to BCPA goes through, the search form submits included. It keeps to a
+// request rate budget, caps the requests in flight, gives each attempt a timeout and retries transient errors,
+// 429 and 5xx answers of GET and HEAD requests with jittered exponential backoff. One is shared by every lookup in
+// the process
+type Polite struct {
+	Transport http.RoundTripper
+	// RequestsPerSecond the rate budget, 0 for none
+	RequestsPerSecond float64
+	// MaxConcurrent requests in flight at once, 0 for no cap
+	MaxConcurrent int
+	// MaxRetries attempts after the first
+	MaxRetries int
+	// RetryPosts retry the search form submits as well, a POST BCPA got but didn't answer would run twice
+	RetryPosts bool
+	// Backoff the wait before the first retry, doubled for each one after up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout of each attempt, reading the body included
+	Timeout   time.Duration
+	UserAgent string
+
+	once  sync.Once
+	slots chan struct{}
+	mu    sync.Mutex
+	next  time.Time
+}
+
+// NewPolite a transport with the default budget: 2 requests a second, 4 at once, 3 retries and 15s per attempt
+func NewPolite() *Polite {
+	return &Polite{
+		Transport:         http.DefaultTransport,
+		RequestsPerSecond: 2,
+		MaxConcurrent:     4,
+		MaxRetries:        3,
+		Backoff:           500 * time.Millisecond,
+		MaxBackoff:        10 * time.Second,
+		Timeout:           15 * time.Second,
+		UserAgent:         DefaultUserAgent,
+	}
+}
+
+// Configure set the budget from a spec like "rps=1,concurrency=2,retries=5,backoff=1s,timeout=20s", the settings
+// left out keep their value
+func (p *Polite) Configure(spec string) error {
+
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid upstream setting %q, expected name=value", pair)
+		}
+
+		var err error
+		switch parts[0] {
+		case "rps":
+			p.RequestsPerSecond, err = strconv.ParseFloat(parts[1], 64)
+		case "concurrency":
+			p.MaxConcurrent, err = strconv.Atoi(parts[1])
+		case "retries":
+			p.MaxRetries, err = strconv.Atoi(parts[1])
+		case "backoff":
+			p.Backoff, err = time.ParseDuration(parts[1])
+		case "max-backoff":
+			p.MaxBackoff, err = time.ParseDuration(parts[1])
+		case "timeout":
+			p.Timeout, err = time.ParseDuration(parts[1])
+		case "retry-posts":
+			p.RetryPosts, err = strconv.ParseBool(parts[1])
+		default:
+			return fmt.Errorf("unknown upstream setting %q, expected rps, concurrency, retries, backoff, max-backoff, timeout or retry-posts", parts[0])
+		}
+
+		if err != nil || strings.HasPrefix(parts[1], "-") {
+			return fmt.Errorf("invalid upstream setting %q", pair)
+		}
+	}
+
+	return nil
+}
+
+// RoundTrip send the request within the budget, retrying it while the failure looks transient
+func (p *Polite) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	p.once.Do(func() {
+		if p.MaxConcurrent > 0 {
+			p.slots = make(chan struct{}, p.MaxConcurrent)
+		}
+	})
+
+	//Only requests that are safe to send twice, and a body that can't be read again can't be retried
+	retries := p.MaxRetries
+	if !idempotent(req.Method) && !p.RetryPosts {
+		retries = 0
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		resp, err := p.attempt(req)
+
+		if attempt >= retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+
+		wait := p.backoff(attempt, resp)
+		if err != nil {
+			log.Printf("retrying %s %s in %s: %v", req.Method, req.URL, wait, err)
+		} else {
+			log.Printf("retrying %s %s in %s: %s", req.Method, req.URL, wait, resp.Status)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// attempt one try of the request, holding a slot and a timeout until its body is closed
+func (p *Polite) attempt(req *http.Request) (*http.Response, error) {
+
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	release := func() {
+		if p.slots != nil {
+			<-p.slots
+		}
+	}
+
+	if err := p.wait(req.Context()); err != nil {
+		release()
+		return nil, err
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+	}
+
+	out := req.Clone(ctx)
+	if p.UserAgent != "" {
+		out.Header.Set("User-Agent", p.UserAgent)
+	}
+
+	resp, err := p.Transport.RoundTrip(out)
+	if err != nil {
+		cancel()
+		release()
+		return nil, err
+	}
+
+	resp.Body = &doneBody{ReadCloser: resp.Body, done: func() { cancel(); release() }}
+
+	return resp, nil
+}
+
+// wait for the request's turn in the rate budget
+func (p *Polite) wait(ctx context.Context) error {
+
+	if p.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	turn := p.next
+	p.next = p.next.Add(time.Duration(float64(time.Second) / p.RequestsPerSecond))
+	p.mu.Unlock()
+
+	return sleep(ctx, turn.Sub(now))
+}
+
+// backoff the full jitter wait before a retry, longer when the answer asks for it with Retry-After
+func (p *Polite) backoff(attempt int, resp *http.Response) time.Duration {
+
+	ceiling := p.Backoff << uint(attempt)
+	if ceiling > p.MaxBackoff || ceiling <= 0 {
+		ceiling = p.MaxBackoff
+	}
+
+	wait := time.Duration(0)
+	if ceiling > 0 {
+		wait = time.Duration(rand.Int63n(int64(ceiling) + 1))
+	}
+
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if after := time.Duration(seconds) * time.Second; after > wait {
+				wait = after
+			}
+		}
+		if wait > p.MaxBackoff {
+			wait = p.MaxBackoff
+		}
+	}
+
+	return wait
+}
+
+// retryable a failure that might not happen again: a network error or timeout of the attempt, 429 or a 5xx.
+// Nothing is retried once the caller has given up
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// idempotent a method that can be sent again without doing anything twice
+func idempotent(method string) bool {
+	return method == "" || method == http.MethodGet || method == http.MethodHead
+}
+
+// sleep for d unless ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// doneBody a response body that lets go of the attempt's slot and timeout once it's closed
+type doneBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,164 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// quick a polite transport without the waits
+func quick() *Polite {
+	p := NewPolite()
+	p.RequestsPerSecond = 0
+	p.Backoff, p.MaxBackoff = time.Millisecond, 5*time.Millisecond
+	return p
+}
+
+func TestPoliteRetries(t *testing.T) {
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, DefaultUserAgent, r.UserAgent())
+		r.ParseForm()
+		assert.Equal(t, "SMITH JOHN", r.PostForm.Get("Owner_Name"))
+
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html>"))
+	}))
+	defer server.Close()
+
+	//A form post isn't sent twice unless asked to
+	client := &http.Client{Transport: quick()}
+	resp, err := client.PostForm(server.URL, url.Values{"Owner_Name": {"SMITH JOHN"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls)
+	resp.Body.Close()
+
+	//Then it's replayed with its body
+	p := quick()
+	p.RetryPosts = true
+	client = &http.Client{Transport: p}
+	resp, err = client.PostForm(server.URL, url.Values{"Owner_Name": {"SMITH JOHN"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls)
+	resp.Body.Close()
+}
+
+func TestPoliteGivesUp(t *testing.T) {
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	live := NewLiveThrough(quick())
+
+	_, err := live.Get(context.Background(), server.URL+"/down")
+	assert.Contains(t, err.Error(), "502")
+	assert.Equal(t, int32(4), calls)
+
+	//Not worth asking again
+	_, err = live.Get(context.Background(), server.URL+"/missing")
+	assert.Contains(t, err.Error(), "404")
+	assert.Equal(t, int32(5), calls)
+}
+
+func TestPoliteTimeout(t *testing.T) {
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p := quick()
+	p.Timeout, p.MaxRetries = 20*time.Millisecond, 1
+
+	start := time.Now()
+	_, err := NewLiveThrough(p).Get(context.Background(), server.URL)
+
+	assert.NotNil(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestPoliteBudget(t *testing.T) {
+
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	p := quick()
+	p.MaxConcurrent, p.RequestsPerSecond = 2, 100
+	live := NewLiveThrough(p)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := live.Get(context.Background(), server.URL)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	//Six requests at 100 a second can't start in under 50ms, two at a time take at least 60ms
+	assert.Equal(t, 2, most)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(60*time.Millisecond))
+}
+
+func TestPoliteConfigure(t *testing.T) {
+
+	p := NewPolite()
+	assert.Nil(t, p.Configure("rps=0.5, concurrency=1,timeout=30s,retry-posts=true"))
+	assert.True(t, p.RetryPosts)
+	assert.Equal(t, 0.5, p.RequestsPerSecond)
+	assert.Equal(t, 1, p.MaxConcurrent)
+	assert.Equal(t, 30*time.Second, p.Timeout)
+	assert.Equal(t, 3, p.MaxRetries)
+
+	for _, spec := range []string{"rps", "burst=3", "retries=-1", "timeout=soon", "retry-posts=maybe"} {
+		assert.NotNil(t, p.Configure(spec), spec)
+	}
+}
@@ -0,0 +1,139 @@
+package lookup
+
+import (
+	"app/model"
+	"app/shared/cache"
+	"app/shared/parse"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Flights collapses concurrent lookups of the same parcel into one scrape, every caller that asked while it was
+// running gets its result or error. Nothing is kept once it's done, that's the cache's job
+type Flights struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+	// joined how many callers took the result of a lookup already running
+	joined int
+}
+
+// flight a lookup in progress and the callers waiting on it
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// NewFlights no lookups in flight
+func NewFlights() *Flights {
+	return &Flights{calls: map[string]*flight{}}
+}
+
+// Do run fn for the key, or wait for the run already in flight for it. Shared tells a caller it got another's result.
+// A caller that's waiting stops once its ctx is done, the run goes on for the others
+func (g *Flights) Do(ctx context.Context, key string, fn func() (interface{}, error)) (value interface{}, shared bool, err error) {
+
+	g.mu.Lock()
+	if f, ok := g.calls[key]; ok {
+		g.joined++
+		g.mu.Unlock()
+
+		select {
+		case <-f.done:
+			return f.value, true, f.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+
+	//Until fn returns the waiting callers would get this, a panic leaves it for them
+	f := &flight{done: make(chan struct{}), err: fmt.Errorf("lookup %s did not finish", key)}
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+
+		close(f.done)
+	}()
+
+	f.value, f.err = fn()
+
+	return f.value, false, f.err
+}
+
+// InFlight the number of lookups running
+func (g *Flights) InFlight() int {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.calls)
+}
+
+// Joined the number of callers that took the result of a lookup already running instead of scraping
+func (g *Flights) Joined() int {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.joined
+}
+
+// landed what a collapsed lookup hands the callers that joined it, the result and what it was served from the cache
+type landed struct {
+	value  interface{}
+	cached *cache.Fetcher
+}
+
+// collapse run the lookup unless the same one is already in flight, then take its result. The key names the
+// lookup and its normalized input, the profile is added since it changes what the pages parse to. The lookup
+// runs with the ctx of the caller that started it, one that joined and still has time when that caller ran out
+// runs it again itself
+func (p *Pipeline) collapse(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+
+	if p.Flights == nil {
+		return fn(ctx)
+	}
+
+	v, shared, err := p.Flights.Do(ctx, key+"@"+parse.ProfileVersion(p.Profile), func() (interface{}, error) {
+		v, err := fn(ctx)
+		return landed{v, p.cached}, err
+	})
+
+	l, _ := v.(landed)
+	if shared && ctx.Err() == nil && (parse.GaveUp(err) || incomplete(l.value)) {
+		return fn(ctx)
+	}
+	if shared {
+		p.cached, p.Shared = l.cached, true
+	}
+
+	return l.value, err
+}
+
+// incomplete a lookup result cut short by its deadline
+func incomplete(v interface{}) bool {
+
+	switch v := v.(type) {
+	case model.Bcpa:
+		return v.Incomplete
+	case []model.ParcelSearchResult:
+		for _, r := range v {
+			if r.Incomplete || (r.Bcpa != nil && r.Bcpa.Incomplete) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ownerKey the owner search the same whatever the case and spacing
+func ownerKey(owner string, hydrate bool) string {
+	return fmt.Sprintf("%s:%s:%t", LookupOwner, strings.ToUpper(strings.Join(strings.Fields(owner), " ")), hydrate)
+}
@@ -0,0 +1,174 @@
+package lookup
+
+import (
+	"app/model"
+	"app/shared/fetch"
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fixtures = filepath.Join("..", "..", "..", "testdata", "bcpa")
+
+// gatedFetcher counts the pages fetched and holds the parcel page until released
+type gatedFetcher struct {
+	fetch.Fetcher
+	release chan struct{}
+
+	mu      sync.Mutex
+	fetched map[string]int
+}
+
+func (g *gatedFetcher) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+	g.mu.Lock()
+	g.fetched[fetch.FixtureName(rawURL, nil)]++
+	g.mu.Unlock()
+
+	<-g.release
+	return g.Fetcher.Get(ctx, rawURL)
+}
+
+func (g *gatedFetcher) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*fetch.Page, error) {
+	g.mu.Lock()
+	g.fetched[fetch.FixtureName(formURL, values)]++
+	g.mu.Unlock()
+
+	<-g.release
+	return g.Fetcher.Submit(ctx, formURL, selector, values)
+}
+
+// waitJoined wait for n callers to join the lookup in flight
+func waitJoined(t *testing.T, flights *Flights, n int) {
+	for deadline := time.Now().Add(5 * time.Second); flights.Joined() < n; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers joined, expected %d", flights.Joined(), n)
+		}
+	}
+}
+
+func TestFlightsCollapseFolio(t *testing.T) {
+
+	g := &gatedFetcher{Fetcher: fetch.NewFixtures(fixtures), release: make(chan struct{}), fetched: map[string]int{}}
+	flights := NewFlights()
+
+	const callers = 5
+	records := make([]model.Bcpa, callers)
+	shared := make([]bool, callers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			//The same folio written two ways
+			folio := "504203060330"
+			if i%2 == 1 {
+				folio = "5042-03-06-0330"
+			}
+
+			p := NewPipeline(g, DefaultBaseURL)
+			p.Flights = flights
+
+			bcpa, err := p.ByFolio(context.Background(), folio)
+			assert.Nil(t, err)
+			records[i], shared[i] = bcpa, p.Shared
+		}(i)
+	}
+
+	waitJoined(t, flights, callers-1)
+	close(g.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, g.fetched["RecInfo.asp_URL_Folio_504203060330.html"])
+	assert.Equal(t, 0, flights.InFlight())
+
+	leaders := 0
+	for i := range records {
+		assert.Equal(t, "504203060330", records[i].ID)
+		if !shared[i] {
+			leaders++
+		}
+	}
+	assert.Equal(t, 1, leaders)
+}
+
+func TestFlightsOutOfTime(t *testing.T) {
+
+	g := &gatedFetcher{Fetcher: fetch.NewFixtures(fixtures), release: make(chan struct{}), fetched: map[string]int{}}
+	flights := NewFlights()
+
+	//The lookup that started the scrape gives up while another waits on it
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		p := NewPipeline(g, DefaultBaseURL)
+		p.Flights = flights
+		_, err := p.ByFolio(ctx, "504203060330")
+		leader <- err
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); flights.InFlight() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the lookup never started")
+		}
+	}
+
+	follower := make(chan model.Bcpa, 1)
+	go func() {
+		p := NewPipeline(g, DefaultBaseURL)
+		p.Flights = flights
+		bcpa, err := p.ByFolio(context.Background(), "504203060330")
+		assert.Nil(t, err)
+		follower <- bcpa
+	}()
+
+	waitJoined(t, flights, 1)
+	cancel()
+	close(g.release)
+
+	assert.True(t, errors.Is(<-leader, context.Canceled))
+
+	//The one still in time scraped the parcel itself
+	bcpa := <-follower
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.False(t, bcpa.Incomplete)
+	assert.Equal(t, 2, g.fetched["RecInfo.asp_URL_Folio_504203060330.html"])
+}
+
+func TestFlightsShareErrors(t *testing.T) {
+
+	flights := NewFlights()
+	release := make(chan struct{})
+	failed := errors.New("bcpa.net is down")
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, _, err := flights.Do(context.Background(), "folio:504203060330", func() (interface{}, error) {
+				<-release
+				return nil, failed
+			})
+			errs <- err
+		}()
+	}
+
+	waitJoined(t, flights, 2)
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, failed, <-errs)
+	}
+
+	//Nothing is kept once the lookup is done
+	v, shared, err := flights.Do(context.Background(), "folio:504203060330", func() (interface{}, error) { return "again", nil })
+	assert.Equal(t, "again", v)
+	assert.False(t, shared)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,444 @@
+package lookup
+
+import (
+	"app/model"
+	"app/shared/archive"
+	"app/shared/cache"
+	"app/shared/fetch"
+	"app/shared/parse"
+	"app/shared/problem"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL the BCPA site
+const DefaultBaseURL = "http://www.bcpa.net/"
+
+// Address the RecAddr.asp search form fields, tagged with the query parameter names the API takes them as
+type Address struct {
+	StreetNumber    string `json:"SN"`
+	UnitNumber      string `json:"UN"`
+	StreetDirection string `json:"SD"`
+	StreetName      string `json:"HN"`
+	StreetType      string `json:"ST"`
+	PostDirection   string `json:"PD"`
+	City            string `json:"CT"`
+}
+
+// Values the form values submitted to RecAddr.asp
+func (a Address) Values() url.Values {
+	return url.Values{
+		"Situs_Street_Number":    {a.StreetNumber},
+		"Situs_Street_Direction": {a.StreetDirection},
+		"Situs_Street_Name":      {a.StreetName},
+		"Situs_Street_Type":      {a.StreetType},
+		"Situs_Street_Post_Dir":  {a.PostDirection},
+		"Situs_Unit_Number":      {a.UnitNumber},
+		"Situs_City":             {a.City},
+	}
+}
+
+// Input the fields by their query parameter names, the way an archived lookup records them
+func (a Address) Input() map[string]string {
+	return map[string]string{
+		"SN": a.StreetNumber,
+		"UN": a.UnitNumber,
+		"SD": a.StreetDirection,
+		"HN": a.StreetName,
+		"ST": a.StreetType,
+		"PD": a.PostDirection,
+		"CT": a.City,
+	}
+}
+
+// AddressFromInput the address an archived lookup recorded
+func AddressFromInput(in map[string]string) Address {
+	return Address{
+		StreetNumber:    in["SN"],
+		UnitNumber:      in["UN"],
+		StreetDirection: in["SD"],
+		StreetName:      in["HN"],
+		StreetType:      in["ST"],
+		PostDirection:   in["PD"],
+		City:            in["CT"],
+	}
+}
+
+// CandidatesError returned when a search matched several parcels so the caller can pick one
+type CandidatesError struct {
+	Candidates []model.ParcelSearchResult
+}
+
+func (e *CandidatesError) Error() string {
+	return fmt.Sprintf("%d parcels matched the search, search again by folio", len(e.Candidates))
+}
+
+// Unwrap carries the ambiguous match catalogue code
+func (e *CandidatesError) Unwrap() error {
+	return problem.New(problem.CodeAmbiguousMatch, e.Error())
+}
+
+// Pipeline one lookup from search to record. Every lookup gets its own so the records it builds are never
+// shared with another request, a warm Lambda container or the HTTP server can run them side by side
+type Pipeline struct {
+	Fetcher fetch.Fetcher
+	BaseURL string
+	// Profile the selectors the pages are parsed with, nil for the default profile
+	Profile *parse.Profile
+	// Archive keeps the raw pages of every lookup, nil to not archive
+	Archive archive.Store
+	// ArchiveTimeout how long saving a lookup to the archive may hold up its answer, DefaultArchiveTimeout when 0
+	ArchiveTimeout time.Duration
+	// Cache answers the pages it has fresh instead of fetching them, nil to always fetch
+	Cache *cache.Cache
+	// CacheControl how the lookup uses the cache
+	CacheControl cache.Control
+	// Flights collapses this lookup into an identical one already running, nil to always run it
+	Flights *Flights
+	// Shared set when the lookup joined one already running instead of scraping
+	Shared bool
+
+	cached *cache.Fetcher
+}
+
+// NewPipeline a pipeline fetching from the BCPA site at baseURL
+func NewPipeline(f fetch.Fetcher, baseURL string) *Pipeline {
+	return &Pipeline{Fetcher: f, BaseURL: baseURL}
+}
+
+// fetcher the fetcher a lookup reads through, the cache in front of the pipeline's when there's one
+func (p *Pipeline) fetcher() fetch.Fetcher {
+
+	if p.Cache == nil {
+		return p.Fetcher
+	}
+
+	p.cached = p.Cache.Fetcher(p.Fetcher, p.CacheControl)
+	return p.cached
+}
+
+// keep cache the pages the record was built from, leaving out the pages any section that failed was parsed from
+func (p *Pipeline) keep(bcpa *model.Bcpa) {
+
+	if p.cached == nil || bcpa == nil || bcpa.Provenance == nil {
+		return
+	}
+
+	failed := map[string]bool{}
+	for _, e := range bcpa.Errors {
+		failed[parse.SectionPage(e.Section)] = true
+	}
+
+	for _, s := range bcpa.Provenance.Sources {
+		if !failed[s.Section] {
+			p.cached.Keep(s.URL)
+		}
+	}
+}
+
+// CacheStatus what the lookup was served from the cache, false when the pipeline has none
+func (p *Pipeline) CacheStatus() (cache.Status, bool) {
+
+	if p.cached == nil {
+		return cache.Status{}, false
+	}
+
+	return p.cached.Status(), true
+}
+
+// Lookup kinds, as archived
+const (
+	LookupAddress = "address"
+	LookupFolio   = "folio"
+	LookupOwner   = "owner"
+)
+
+// DefaultArchiveTimeout how long saving a lookup to the archive may take before it's given up
+const DefaultArchiveTimeout = 2 * time.Second
+
+// archived the fetcher a lookup uses and the function saving what it fetched once the lookup is done.
+// Archiving is best effort, a store that fails or is too slow is logged and the lookup still answers
+func (p *Pipeline) archived(ctx context.Context, lookup string, input map[string]string) (fetch.Fetcher, func(subject string, err error)) {
+
+	f := p.fetcher()
+
+	if p.Archive == nil {
+		return f, func(string, error) {}
+	}
+
+	r := archive.NewRecorder(f)
+
+	return r, func(subject string, err error) {
+
+		m := archive.Manifest{
+			Lookup:         lookup,
+			Input:          input,
+			BaseURL:        p.BaseURL,
+			ParserVersion:  parse.ParserVersion,
+			ProfileVersion: parse.ProfileVersion(p.Profile),
+		}
+		if err != nil {
+			m.Error = err.Error()
+		}
+
+		timeout := p.ArchiveTimeout
+		if timeout == 0 {
+			timeout = DefaultArchiveTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		if key, err := r.Save(ctx, p.Archive, subject, m); err != nil {
+			log.Printf("archiving %s lookup %s failed: %v", lookup, key, err)
+		}
+	}
+}
+
+// ByAddress submit the RecAddr.asp form and load the parcel it lands on
+func (p *Pipeline) ByAddress(ctx context.Context, a Address) (model.Bcpa, error) {
+
+	v, err := p.collapse(ctx, LookupAddress+":"+cache.AddressKey(a.Input()), func(ctx context.Context) (interface{}, error) {
+		return p.byAddress(ctx, a)
+	})
+
+	bcpa, _ := v.(model.Bcpa)
+	return bcpa, err
+}
+
+func (p *Pipeline) byAddress(ctx context.Context, a Address) (bcpa model.Bcpa, err error) {
+
+	input := a.Input()
+	f, save := p.archived(ctx, LookupAddress, input)
+	defer func() { save(bcpa.ID, err) }()
+
+	baseURL := p.BaseURL
+
+	//An address found before goes straight to the parcel page of its folio, recorded so a replay does the same
+	if p.Cache != nil {
+		if folio, ok := p.Cache.Folio(input, p.CacheControl); ok {
+			input["folio"] = folio
+			return p.loadFolio(ctx, f, folio)
+		}
+	}
+
+	// Submit the search form
+	page, err := f.Submit(ctx, baseURL+"RecAddr.asp", "[name='homeind']", a.Values())
+	if err != nil {
+		return model.Bcpa{}, err
+	}
+
+	//Work out where the form sent us before parsing anything
+	doc, err := page.Document()
+	if err != nil {
+		return model.Bcpa{}, problem.Wrap(problem.CodeUpstreamLayoutChanged, err)
+	}
+
+	switch outcome, candidates := parse.ClassifySearchResult(doc, p.Profile); outcome {
+	case parse.SearchNotFound:
+		return model.Bcpa{}, parse.ErrNotFound
+	case parse.SearchCandidates:
+		return model.Bcpa{}, &CandidatesError{candidates}
+	}
+
+	//Load the BCPA parent node, its sections and cards from the HTML receieved from URL.
+	//Sections that fail are listed in the record's errors, the rest is still returned
+	bcpa = parse.LoadBcpa(ctx, f, page, doc, baseURL, p.Profile)
+
+	//A parcel page missing its required fields means the layout changed, not that the parcel is blank
+	if err = parse.CheckParcel(doc, bcpa, page.URL, p.Profile); err != nil {
+		return model.Bcpa{}, err
+	}
+
+	//The page the search landed on is the parcel page of the folio
+	if p.Cache != nil {
+		p.Cache.KeepFolio(a.Input(), bcpa.ID, p.CacheControl)
+		p.Cache.Keep(parse.FolioURL(baseURL, bcpa.ID), page, p.CacheControl)
+		p.keep(&bcpa)
+	}
+
+	return bcpa, nil
+}
+
+// ByFolio load the parcel page for a folio / parcel ID without the address round-trip
+func (p *Pipeline) ByFolio(ctx context.Context, folio string) (model.Bcpa, error) {
+
+	folio, err := parse.NormalizeFolio(folio)
+	if err != nil {
+		return model.Bcpa{}, problem.Wrap(problem.CodeValidation, err)
+	}
+
+	v, err := p.collapse(ctx, LookupFolio+":"+folio, func(ctx context.Context) (interface{}, error) {
+		return p.byFolio(ctx, folio)
+	})
+
+	bcpa, _ := v.(model.Bcpa)
+	return bcpa, err
+}
+
+func (p *Pipeline) byFolio(ctx context.Context, folio string) (bcpa model.Bcpa, err error) {
+
+	//The folio is known up front, archive under it even when the page turns out empty
+	f, save := p.archived(ctx, LookupFolio, map[string]string{"folio": folio})
+	defer func() { save(folio, err) }()
+
+	return p.loadFolio(ctx, f, folio)
+}
+
+// loadFolio load the parcel page of a folio and the sections it links to
+func (p *Pipeline) loadFolio(ctx context.Context, f fetch.Fetcher, folio string) (model.Bcpa, error) {
+
+	bcpa, err := parse.LoadBcpaFromFolio(ctx, f, folio, p.BaseURL, p.Profile)
+	if err != nil {
+		return model.Bcpa{}, err
+	}
+
+	//BCPA answers an unknown folio with an empty parcel page
+	if bcpa.ID == "" {
+		return model.Bcpa{}, parse.ErrNotFound
+	}
+
+	p.keep(&bcpa)
+
+	return bcpa, nil
+}
+
+// ByOwner submit the BCPA owner name search and return the matching parcels, optionally with the full record for each
+func (p *Pipeline) ByOwner(ctx context.Context, owner string, hydrate bool) ([]model.ParcelSearchResult, error) {
+
+	owner = strings.TrimSpace(owner)
+	if owner == "" {
+		return nil, problem.New(problem.CodeValidation, "missing owner name")
+	}
+
+	v, err := p.collapse(ctx, ownerKey(owner, hydrate), func(ctx context.Context) (interface{}, error) {
+		return p.byOwner(ctx, owner, hydrate)
+	})
+
+	//Every caller gets a slice of its own to rewrite, the parcels in it are shared
+	results, _ := v.([]model.ParcelSearchResult)
+	if p.Flights != nil && results != nil {
+		results = append([]model.ParcelSearchResult{}, results...)
+	}
+
+	return results, err
+}
+
+func (p *Pipeline) byOwner(ctx context.Context, owner string, hydrate bool) (results []model.ParcelSearchResult, err error) {
+
+	f, save := p.archived(ctx, LookupOwner, map[string]string{"owner": owner, "hydrate": fmt.Sprint(hydrate)})
+	defer func() { save(archive.SubjectSearch, err) }()
+
+	baseURL := p.BaseURL
+
+	// Submit the search form
+	page, err := f.Submit(ctx, baseURL+"RecName.asp", "form", url.Values{"Owner_Name": {owner}})
+	if err != nil {
+		return nil, err
+	}
+
+	//The results are the response to the POST, parse the page we're on
+	doc, err := page.Document()
+	if err != nil {
+		return nil, problem.Wrap(problem.CodeUpstreamLayoutChanged, err)
+	}
+
+	outcome, results := parse.ClassifySearchResult(doc, p.Profile)
+
+	if outcome == parse.SearchNotFound {
+		return nil, parse.ErrNotFound
+	}
+
+	if hydrate {
+		parse.HydrateSearchResults(ctx, f, results, baseURL, p.Profile)
+		for i := range results {
+			p.keep(results[i].Bcpa)
+		}
+	}
+
+	return results, nil
+}
+
+// Card fetch and parse a single building card page
+func (p *Pipeline) Card(ctx context.Context, cardURL string) (model.RecBuildingCard, error) {
+
+	//The card parser fills in the cards of a record, give it one to fill. Its provenance is what tells keep the
+	//card page is one to cache
+	bcpa := model.Bcpa{Provenance: parse.NewProvenance(p.Profile)}
+	bcpa.LandCalculations.Cards = []model.RecBuildingCard{{CardURL: url.QueryEscape(cardURL)}}
+
+	if err := parse.ExtractCardURL(ctx, p.fetcher(), cardURL, 0, &bcpa, p.BaseURL, p.Profile); err != nil {
+		return model.RecBuildingCard{}, err
+	}
+	p.keep(&bcpa)
+
+	return bcpa.LandCalculations.Cards[0], nil
+}
+
+// Replayed the outcome of running an archived lookup again
+type Replayed struct {
+	Manifest archive.Manifest `json:"manifest"`
+	// Record the parcel of a folio or address lookup
+	Record *model.Bcpa `json:"record,omitempty"`
+	// Results the parcels of an owner search
+	Results []model.ParcelSearchResult `json:"results,omitempty"`
+	// Error the replay failed with, compare it with the manifest's
+	Error string `json:"error,omitempty"`
+}
+
+// Replay run an archived lookup again with the parser of this build, against exactly the pages it fetched.
+// The key is a full archive key, or a folio for its latest lookup. A nil profile uses the default
+func Replay(ctx context.Context, store archive.Store, key string, profile *parse.Profile) (Replayed, error) {
+
+	key, err := archive.Resolve(ctx, store, key)
+	if err != nil {
+		return Replayed{}, err
+	}
+
+	r, err := archive.NewReplayer(ctx, store, key)
+	if err != nil {
+		return Replayed{}, err
+	}
+
+	//Links on the pages resolve against the site they were fetched from
+	p := &Pipeline{Fetcher: r, BaseURL: r.Manifest.BaseURL, Profile: profile}
+	if p.BaseURL == "" {
+		p.BaseURL = DefaultBaseURL
+	}
+
+	replayed := Replayed{Manifest: r.Manifest}
+
+	var lerr error
+
+	switch r.Manifest.Lookup {
+	case LookupFolio:
+		var bcpa model.Bcpa
+		if bcpa, lerr = p.ByFolio(ctx, r.Manifest.Input["folio"]); lerr == nil {
+			replayed.Record = &bcpa
+		}
+	case LookupAddress:
+		var bcpa model.Bcpa
+		//An address answered from the cache never ran the search, its folio is recorded instead
+		if folio := r.Manifest.Input["folio"]; folio != "" {
+			bcpa, lerr = p.ByFolio(ctx, folio)
+		} else {
+			bcpa, lerr = p.ByAddress(ctx, AddressFromInput(r.Manifest.Input))
+		}
+		if lerr == nil {
+			replayed.Record = &bcpa
+		}
+	case LookupOwner:
+		replayed.Results, lerr = p.ByOwner(ctx, r.Manifest.Input["owner"], r.Manifest.Input["hydrate"] == "true")
+	default:
+		return replayed, fmt.Errorf("archived lookup %s has unknown kind %q", key, r.Manifest.Lookup)
+	}
+
+	if lerr != nil {
+		replayed.Error = lerr.Error()
+	}
+
+	return replayed, nil
+}
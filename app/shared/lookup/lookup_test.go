@@ -0,0 +1,162 @@
+package lookup
+
+import (
+	"app/shared/archive"
+	"app/shared/cache"
+	"app/shared/fetch"
+	"app/shared/parse"
+	"app/shared/problem"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyFetcher answers a maintenance page the first time a URL is fetched, the saved page after that
+type flakyFetcher struct {
+	fetch.Fetcher
+	fetched map[string]int
+}
+
+func (f *flakyFetcher) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+
+	f.fetched[rawURL]++
+	if f.fetched[rawURL] == 1 {
+		return &fetch.Page{URL: rawURL, Body: []byte("<html><head><title>Maintenance</title></head><body><p>Back soon</p></body></html>")}, nil
+	}
+
+	return f.Fetcher.Get(ctx, rawURL)
+}
+
+func TestCacheKeepsOnlyPagesThatParse(t *testing.T) {
+
+	saved := parse.ReportDrift
+	parse.ReportDrift = func(parse.Drift) {}
+	defer func() { parse.ReportDrift = saved }()
+
+	f := &flakyFetcher{Fetcher: fetch.NewFixtures(fixtures), fetched: map[string]int{}}
+	c := cache.New(cache.NewMemory(0), cache.DefaultTTLs)
+
+	lookup := func() (*Pipeline, error) {
+		p := NewPipeline(f, DefaultBaseURL)
+		p.Cache = c
+		_, err := p.ByFolio(context.Background(), "504203060330")
+		return p, err
+	}
+
+	//The broken parcel page isn't kept, the retry fetches it again
+	_, err := lookup()
+	assert.Equal(t, problem.CodeUpstreamLayoutChanged, problem.CodeOf(err))
+
+	p, err := lookup()
+	assert.Nil(t, err)
+	status, _ := p.CacheStatus()
+	assert.Equal(t, "MISS", status.String())
+
+	//The card and sketch pages were broken the first time they were fetched, only the parcel was kept
+	p, err = lookup()
+	assert.Nil(t, err)
+	status, _ = p.CacheStatus()
+	assert.Equal(t, "PARTIAL", status.String())
+
+	p, err = lookup()
+	assert.Nil(t, err)
+	status, _ = p.CacheStatus()
+	assert.Equal(t, "HIT", status.String())
+
+	for u, n := range f.fetched {
+		assert.Equal(t, 2, n, u)
+	}
+}
+
+// droppedSales a site whose parcel pages lost the sales table
+type droppedSales struct {
+	fetch.Fetcher
+	fetched map[string]int
+}
+
+func (f *droppedSales) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+
+	f.fetched[rawURL]++
+
+	page, err := f.Fetcher.Get(ctx, rawURL)
+	if err != nil || !strings.Contains(rawURL, "RecInfo.asp") {
+		return page, err
+	}
+
+	doc, err := page.Document()
+	if err != nil {
+		return nil, err
+	}
+	parse.LabelTable(doc, parse.HeadingSales).Remove()
+
+	html, err := doc.Html()
+	return &fetch.Page{URL: page.URL, Body: []byte(html), FetchedAt: page.FetchedAt}, err
+}
+
+func TestCacheSkipsParcelPageWithFailedSection(t *testing.T) {
+
+	f := &droppedSales{Fetcher: fetch.NewFixtures(fixtures), fetched: map[string]int{}}
+	c := cache.New(cache.NewMemory(0), cache.DefaultTTLs)
+
+	for i := 0; i < 2; i++ {
+		p := NewPipeline(f, DefaultBaseURL)
+		p.Cache = c
+		bcpa, err := p.ByFolio(context.Background(), "504203060330")
+		assert.Nil(t, err)
+		if assert.Len(t, bcpa.Errors, 1) {
+			assert.Equal(t, parse.SectionSales, bcpa.Errors[0].Section)
+		}
+	}
+
+	//The card and sketch are kept, the parcel page the sales failed on is fetched every time
+	assert.Equal(t, 2, f.fetched[parse.FolioURL(DefaultBaseURL, "504203060330")])
+	for u, n := range f.fetched {
+		if !strings.Contains(u, "RecInfo.asp") {
+			assert.Equal(t, 1, n, u)
+		}
+	}
+}
+
+// hangingStore an archive that never answers until the caller gives up
+type hangingStore struct {
+	archive.Store
+}
+
+func (s hangingStore) Put(ctx context.Context, key string, body []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestArchiveDoesNotHoldUpTheLookup(t *testing.T) {
+
+	p := NewPipeline(fetch.NewFixtures(fixtures), DefaultBaseURL)
+	p.Archive = hangingStore{}
+	p.ArchiveTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	bcpa, err := p.ByFolio(context.Background(), "504203060330")
+	assert.Nil(t, err)
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.True(t, time.Since(start) < time.Second, "took %s", time.Since(start))
+}
+
+func TestCardIsCached(t *testing.T) {
+
+	c := cache.New(cache.NewMemory(0), cache.DefaultTTLs)
+	cardURL := "http://www.bcpa.net/RecBuildingCard.asp?folio=504203060330&taxyear=2018&cardno=1"
+
+	for _, want := range []string{"MISS", "HIT"} {
+		p := NewPipeline(fetch.NewFixtures(fixtures), DefaultBaseURL)
+		p.Cache = c
+
+		card, err := p.Card(context.Background(), cardURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", card.CardNo)
+
+		status, _ := p.CacheStatus()
+		assert.Equal(t, want, status.String())
+	}
+}
@@ -0,0 +1,217 @@
+package normalize
+
+import (
+	"app/model"
+	"encoding/json"
+	"fmt"
+)
+
+// Bcpa build the typed companion of a raw Bcpa record
+func Bcpa(b model.Bcpa) model.TypedBcpa {
+	t := model.TypedBcpa{
+		Siteaddress:    b.Siteaddress,
+		Owner:          b.Owner,
+		MailingAddress: b.MailingAddress,
+		ID:             b.ID,
+		Milage:         b.Milage,
+		Use:            b.Use,
+		Legal:          b.Legal,
+		Errors:         b.Errors,
+		Strategies:     b.Strategies,
+		Provenance:     b.Provenance,
+		Incomplete:     b.Incomplete,
+	}
+
+	for _, pa := range b.PropertyAssessments {
+		t.PropertyAssessments = append(t.PropertyAssessments, PropertyAssessment(pa))
+	}
+
+	t.ExemptionsTaxable = ExemptionsTaxable(b.ExemptionsTaxable)
+
+	for _, sale := range b.SalesHistory {
+		t.SalesHistory = append(t.SalesHistory, Sale(sale))
+	}
+
+	t.LandCalculations = LandCalculations(b.LandCalculations)
+
+	for _, sa := range b.SpecialAssessments {
+		t.SpecialAssessments = append(t.SpecialAssessments, SpecialAssessment(sa))
+	}
+
+	return t
+}
+
+// PropertyAssessment build the typed companion of an assessment row
+func PropertyAssessment(pa model.PropertyAssessmentValue) model.TypedPropertyAssessmentValue {
+	return model.TypedPropertyAssessmentValue{
+		Year:                Int(pa.Year),
+		Land:                Money(pa.Land),
+		BuildingImprovement: Money(pa.BuildingImprovement),
+		JustMarketValue:     Money(pa.JustMarketValue),
+		AssessedSOHValue:    Money(pa.AssessedSOHValue),
+		Tax:                 Money(pa.Tax),
+		CreatedAt:           pa.CreatedAt,
+		UpdatedAt:           pa.UpdatedAt,
+	}
+}
+
+// ExemptionsTaxable build the typed companion of the exemptions by taxing authority
+func ExemptionsTaxable(eta model.ExemptionsTaxableValuesbyTaxingAuthority) model.TypedExemptionsTaxableValuesbyTaxingAuthority {
+	return model.TypedExemptionsTaxableValuesbyTaxingAuthority{
+		County:      ExemptionsAndTaxable(eta.County),
+		SchoolBoard: ExemptionsAndTaxable(eta.SchoolBoard),
+		Municipal:   ExemptionsAndTaxable(eta.Municipal),
+		Independent: ExemptionsAndTaxable(eta.Independent),
+		CreatedAt:   eta.CreatedAt,
+		UpdatedAt:   eta.UpdatedAt,
+	}
+}
+
+// ExemptionsAndTaxable build the typed companion of one taxing authority column
+func ExemptionsAndTaxable(e model.ExemptionsAndTaxableValue) model.TypedExemptionsAndTaxableValue {
+	return model.TypedExemptionsAndTaxableValue{
+		JustValue:    Money(e.JustValue),
+		Portability:  Money(e.Portability),
+		AssessedSOH:  Money(e.AssessedSOH),
+		Homestead:    Money(e.Homestead),
+		AddHomestead: Money(e.AddHomestead),
+		WidVetDis:    Money(e.WidVetDis),
+		Senior:       Money(e.Senior),
+		XemptType:    e.XemptType,
+		Taxable:      Money(e.Taxable),
+	}
+}
+
+// Sale build the typed companion of a sale
+func Sale(s model.Sale) model.TypedSale {
+	return model.TypedSale{
+		Date:        Date(s.Date),
+		Type:        s.Type,
+		Price:       Money(s.Price),
+		BookPageCIN: s.BookPageCIN,
+	}
+}
+
+// LandCalculations build the typed companion of the land calculations and their cards
+func LandCalculations(lcs model.LandCalculations) model.TypedLandCalculations {
+	t := model.TypedLandCalculations{
+		AdjBldgSF:       Number(lcs.AdjBldgSF),
+		Units:           Int(lcs.Units),
+		SketchURL:       lcs.SketchURL,
+		EffActYearBuilt: lcs.EffActYearBuilt,
+	}
+
+	t.EffYearBuilt, t.ActYearBuilt = Years(lcs.EffActYearBuilt)
+
+	for _, lc := range lcs.Calculations {
+		t.Calculations = append(t.Calculations, model.TypedLandCalculation{
+			Price:  Money(lc.Price),
+			Factor: Number(lc.Factor),
+			Type:   lc.Type,
+		})
+	}
+
+	for _, card := range lcs.Cards {
+		t.Cards = append(t.Cards, Card(card))
+	}
+
+	if lcs.Sketch != nil {
+		sketch := Sketch(*lcs.Sketch)
+		t.Sketch = &sketch
+	}
+
+	return t
+}
+
+// Sketch build the typed companion of a sketch and its sub-areas
+func Sketch(s model.RecPatriotSketch) model.TypedRecPatriotSketch {
+	t := model.TypedRecPatriotSketch{
+		Sketch:       s.Sketch,
+		Building:     s.Building,
+		URL:          s.URL,
+		SketchImgURL: s.SketchImgURL,
+		AdjAreaTotal: Number(s.AdjAreaTotal),
+	}
+
+	for _, c := range s.Codes {
+		t.Codes = append(t.Codes, model.TypedPatriotSketchCode{
+			Code:        c.Code,
+			Description: c.Description,
+			Area:        Number(c.Area),
+			Factor:      Number(c.Factor),
+			AdjArea:     Number(c.AdjArea),
+			Stories:     Number(c.Stories),
+		})
+	}
+
+	return t
+}
+
+// Card build the typed companion of a building card
+func Card(c model.RecBuildingCard) model.TypedRecBuildingCard {
+	t := model.TypedRecBuildingCard{
+		CardURL:                   c.CardURL,
+		CardNo:                    c.CardNo,
+		TaxYear:                   Int(c.TaxYear),
+		Folio:                     c.Folio,
+		ParcelIDNumber:            c.ParcelIDNumber,
+		UseCode:                   c.UseCode,
+		NoBedrooms:                Int(c.NoBedrooms),
+		NoBaths:                   Number(c.NoBaths),
+		NoUnits:                   Int(c.NoUnits),
+		NoStories:                 Number(c.NoStories),
+		NoBuildings:               Int(c.NoBuildings),
+		Foundation:                c.Foundation,
+		Exterior:                  c.Exterior,
+		RoofType:                  c.RoofType,
+		RoofMaterial:              c.RoofMaterial,
+		Interior:                  c.Interior,
+		Floors:                    c.Floors,
+		Plumbing:                  c.Plumbing,
+		Electric:                  c.Electric,
+		Classification:            c.Classification,
+		CeilingHeights:            c.CeilingHeights,
+		QualityOfConstruction:     c.QualityOfConstruction,
+		CurrentConditionStructure: c.CurrentConditionStructure,
+		ConstructionClass:         c.ConstructionClass,
+		ExtraFeatures:             c.ExtraFeatures,
+	}
+
+	for _, p := range c.Permits {
+		t.Permits = append(t.Permits, model.TypedPermit{
+			PermitNo:   p.PermitNo,
+			PermitType: p.PermitType,
+			EstCost:    Money(p.EstCost),
+			PermitDate: Date(p.PermitDate),
+			CODate:     Date(p.CODate),
+		})
+	}
+
+	return t
+}
+
+// SpecialAssessment build the typed companion of a special assessment row
+func SpecialAssessment(sa model.SpecialAssessment) model.TypedSpecialAssessment {
+	return model.TypedSpecialAssessment{
+		Fire:  Money(sa.Fire),
+		Garb:  Money(sa.Garb),
+		Light: Money(sa.Light),
+		Drain: Money(sa.Drain),
+		Impr:  Money(sa.Impr),
+		Safe:  Money(sa.Safe),
+		Storm: Money(sa.Storm),
+		Clean: Money(sa.Clean),
+		Misc:  Money(sa.Misc),
+	}
+}
+
+// MarshalBcpa Convert the typed companion of a BCPA record to string
+func MarshalBcpa(b model.Bcpa) string {
+	tb, err := json.Marshal(Bcpa(b))
+	if err != nil {
+		fmt.Printf("Error: %s", err)
+		return "0"
+	}
+
+	return string(tb)
+}
@@ -0,0 +1,154 @@
+package normalize
+
+import (
+	"app/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	//Dates come through as 05/12/2009, sometimes without the leading zeros or with a two digit year
+	dateLayouts = []string{"01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "2006-01-02"}
+
+	//Effective / actual year built comes through as 1985/1972, sometimes only one year is present
+	yearsRe = regexp.MustCompile(`([0-9]{4})\s*/\s*([0-9]{4})|([0-9]{4})`)
+)
+
+// Money parse a currency value like "$123,456" or "($1,234.50)" into cents
+func Money(raw string) model.Money {
+	m := model.Money{Raw: raw}
+
+	s := cleanNumber(raw)
+	if s == "" {
+		return m
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.Trim(s, "()")
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	//Round the fraction to cents
+	frac = (frac + "000")[:3]
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		m.Failed = true
+		return m
+	}
+	f, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		m.Failed = true
+		return m
+	}
+
+	m.Cents = w*100 + (f+5)/10
+	if negative {
+		m.Cents = -m.Cents
+	}
+
+	return m
+}
+
+// Date parse a date like "05/12/2009"
+func Date(raw string) model.Date {
+	d := model.Date{Raw: raw}
+
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return d
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			d.Time = t
+			return d
+		}
+	}
+
+	d.Failed = true
+	return d
+}
+
+// Int parse a whole number like "3" or "1,200"
+func Int(raw string) model.Int {
+	n := model.Int{Raw: raw}
+
+	s := cleanNumber(raw)
+	if s == "" {
+		return n
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		n.Failed = true
+		return n
+	}
+
+	n.Value = v
+	return n
+}
+
+// Number parse a decimal number like "2,345" or "2.5"
+func Number(raw string) model.Number {
+	n := model.Number{Raw: raw}
+
+	s := cleanNumber(raw)
+	if s == "" {
+		return n
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		n.Failed = true
+		return n
+	}
+
+	n.Value = v
+	return n
+}
+
+// Years split the effective / actual year built value like "1985/1972"
+func Years(raw string) (model.Int, model.Int) {
+	eff, act := model.Int{Raw: raw}, model.Int{Raw: raw}
+
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return eff, act
+	}
+
+	m := yearsRe.FindStringSubmatch(s)
+	if m == nil {
+		eff.Failed, act.Failed = true, true
+		return eff, act
+	}
+
+	//A lone year is both the effective and actual year
+	if m[3] != "" {
+		return Int(m[3]), Int(m[3])
+	}
+
+	return Int(m[1]), Int(m[2])
+}
+
+// cleanNumber drop the currency sign, thousands separators, square foot suffix and spaces
+func cleanNumber(raw string) string {
+	s := strings.TrimSpace(raw)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "SqFt"), "SF")
+	return strings.NewReplacer("$", "", ",", "", " ", "", " ", "").Replace(s)
+}
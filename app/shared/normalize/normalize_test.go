@@ -0,0 +1,45 @@
+package normalize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoney(t *testing.T) {
+	assert.Equal(t, int64(12345600), Money("$123,456").Cents)
+	assert.Equal(t, int64(123450), Money("$1,234.50").Cents)
+	assert.Equal(t, int64(-123450), Money("($1,234.50)").Cents)
+	assert.False(t, Money("").Failed)
+	assert.True(t, Money("N/A").Failed)
+	assert.Equal(t, "N/A", Money("N/A").Raw)
+}
+
+func TestDate(t *testing.T) {
+	assert.Equal(t, time.Date(2009, 5, 12, 0, 0, 0, 0, time.UTC), Date("05/12/2009").Time)
+	assert.Equal(t, time.Date(2009, 5, 2, 0, 0, 0, 0, time.UTC), Date("5/2/2009").Time)
+	assert.True(t, Date("Pending").Failed)
+	assert.False(t, Date(" ").Failed)
+}
+
+func TestIntAndNumber(t *testing.T) {
+	assert.Equal(t, 1200, Int("1,200").Value)
+	assert.True(t, Int("2.5").Failed)
+	assert.Equal(t, 2.5, Number("2.5").Value)
+	assert.Equal(t, float64(2345), Number("2,345").Value)
+}
+
+func TestYears(t *testing.T) {
+	eff, act := Years("1985/1972")
+	assert.Equal(t, 1985, eff.Value)
+	assert.Equal(t, 1972, act.Value)
+
+	eff, act = Years("Eff./Act. Year Built: 1990/1961")
+	assert.Equal(t, 1990, eff.Value)
+	assert.Equal(t, 1961, act.Value)
+
+	eff, act = Years("Unknown")
+	assert.True(t, eff.Failed)
+	assert.True(t, act.Failed)
+}
@@ -0,0 +1,276 @@
+package parse
+
+import (
+	"app/model"
+	"app/shared/problem"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Drift what looked wrong about a page. An unknown fingerprint on its own is only reported, missing or
+// implausible required fields mean the parse can't be trusted
+type Drift struct {
+	Page        string   `json:"page"`
+	URL         string   `json:"url,omitempty"`
+	Fingerprint string   `json:"fingerprint"`
+	Known       bool     `json:"known"`
+	Missing     []string `json:"missing,omitempty"`
+	Implausible []string `json:"implausible,omitempty"`
+}
+
+// Broken check if required fields are missing or implausible
+func (d Drift) Broken() bool {
+	return len(d.Missing) > 0 || len(d.Implausible) > 0
+}
+
+// LayoutError returned instead of a record parsed from a page that no longer looks like the one we know
+type LayoutError struct {
+	Drift Drift
+}
+
+func (e *LayoutError) Error() string {
+
+	problems := []string{}
+	if len(e.Drift.Missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(e.Drift.Missing, ", "))
+	}
+	if len(e.Drift.Implausible) > 0 {
+		problems = append(problems, "implausible "+strings.Join(e.Drift.Implausible, ", "))
+	}
+
+	return fmt.Sprintf("%s page layout changed (fingerprint %s): %s", e.Drift.Page, e.Drift.Fingerprint, strings.Join(problems, "; "))
+}
+
+// Unwrap carries the layout changed catalogue code
+func (e *LayoutError) Unwrap() error {
+	return problem.New(problem.CodeUpstreamLayoutChanged, e.Error())
+}
+
+// ReportDrift called for every page that drifted, broken or only unknown. Logs a CloudWatch metric to stderr by
+// default, stdout is left to whatever the process prints
+var ReportDrift = DriftLogger(os.Stderr)
+
+// DriftLogger write each drift to w as a CloudWatch embedded metric, a JSON line the Lambda log picks up as
+// the LayoutDrift metric of the BCPA namespace
+func DriftLogger(w io.Writer) func(Drift) {
+
+	return func(d Drift) {
+
+		b, err := json.Marshal(map[string]interface{}{
+			"_aws": map[string]interface{}{
+				"Timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+				"CloudWatchMetrics": []interface{}{map[string]interface{}{
+					"Namespace":  "BCPA",
+					"Dimensions": [][]string{{"Page", "Broken"}},
+					"Metrics":    []interface{}{map[string]string{"Name": "LayoutDrift", "Unit": "Count"}},
+				}},
+			},
+			"Page":        d.Page,
+			"Broken":      fmt.Sprint(d.Broken()),
+			"LayoutDrift": 1,
+			"URL":         d.URL,
+			"Fingerprint": d.Fingerprint,
+			"Known":       d.Known,
+			"Missing":     d.Missing,
+			"Implausible": d.Implausible,
+		})
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintln(w, string(b))
+	}
+}
+
+// Fingerprint a short hash of the page structure: the title and the nesting of its tables. Rows and values
+// don't count, so every parcel page of one layout shares a fingerprint
+func Fingerprint(doc *goquery.Document) string {
+
+	paths := map[string]bool{}
+
+	doc.Find("table").Each(func(i int, s *goquery.Selection) {
+
+		path := []string{}
+		s.Parents().AddBack().Filter("table").Each(func(i int, t *goquery.Selection) {
+			if id, ok := t.Attr("id"); ok && id != "" {
+				path = append(path, "table#"+id)
+				return
+			}
+			path = append(path, "table")
+		})
+
+		paths[strings.Join(path, ">")] = true
+	})
+
+	lines := []string{}
+	for p := range paths {
+		lines = append(lines, p)
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.TrimSpace(doc.Find("title").Text()) + "\n" + strings.Join(lines, "\n")))
+
+	return hex.EncodeToString(sum[:6])
+}
+
+var (
+	digitsOnly = regexp.MustCompile(`^[0-9]+$`)
+	taxYear    = regexp.MustCompile(`^(19|20)[0-9]{2}$`)
+)
+
+// newDrift fingerprint a page and look it up in the profile
+func newDrift(doc *goquery.Document, page string, pageURL string, p *Profile) Drift {
+
+	d := Drift{Page: page, URL: pageURL, Fingerprint: Fingerprint(doc)}
+
+	for _, fp := range p.PageFingerprints(page) {
+		if fp == d.Fingerprint {
+			d.Known = true
+		}
+	}
+
+	return d
+}
+
+// Checks the outcome of the last pages checked, the health endpoint reports how many parsed
+var Checks = NewTally(200)
+
+// Tally keeps whether each of the last pages checked parsed, older outcomes make room for new ones
+type Tally struct {
+	mu       sync.Mutex
+	outcomes []bool
+	next     int
+	size     int
+}
+
+// NewTally a tally of the last size outcomes
+func NewTally(size int) *Tally {
+	return &Tally{size: size}
+}
+
+// Record the outcome of a page
+func (t *Tally) Record(ok bool) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.outcomes) < t.size {
+		t.outcomes = append(t.outcomes, ok)
+		return
+	}
+
+	t.outcomes[t.next] = ok
+	t.next = (t.next + 1) % t.size
+}
+
+// Counts how many pages the tally holds and how many of them parsed
+func (t *Tally) Counts() (checked int, parsed int) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ok := range t.outcomes {
+		if ok {
+			parsed++
+		}
+	}
+
+	return len(t.outcomes), parsed
+}
+
+// drifted check if the page is worth reporting. Until the profile has fingerprints of the page type to compare
+// with every page is unknown, only a broken one counts then
+func (d Drift) drifted(p *Profile) bool {
+	return d.Broken() || (!d.Known && len(p.PageFingerprints(d.Page)) > 0)
+}
+
+// settle report a drifted page and turn a broken one into an error
+func settle(d Drift, p *Profile) error {
+
+	Checks.Record(!d.Broken())
+
+	if !d.drifted(p) {
+		return nil
+	}
+
+	ReportDrift(d)
+
+	if d.Broken() {
+		return &LayoutError{d}
+	}
+
+	return nil
+}
+
+// CheckParcel check the record parsed from a parcel page has the required fields and they look right.
+// BCPA answers an unknown folio with the parcel page minus the values, that's not found rather than drift
+func CheckParcel(doc *goquery.Document, bcpa model.Bcpa, pageURL string, p *Profile) error {
+
+	d, err := ParcelDrift(doc, bcpa, pageURL, p)
+	if err != nil {
+		return err
+	}
+
+	return settle(d, p)
+}
+
+// ParcelDrift what looks wrong about the record parsed from a parcel page, without recording or reporting it.
+// ErrNotFound for the page BCPA answers an unknown folio with
+func ParcelDrift(doc *goquery.Document, bcpa model.Bcpa, pageURL string, p *Profile) (Drift, error) {
+
+	d := newDrift(doc, PageParcel, pageURL, p)
+
+	if strings.TrimSpace(bcpa.ID) == "" {
+		if LabelCell(doc, LabelID).Size() > 0 {
+			return d, ErrNotFound
+		}
+		d.Missing = append(d.Missing, "id")
+	} else if _, err := NormalizeFolio(bcpa.ID); err != nil {
+		d.Implausible = append(d.Implausible, fmt.Sprintf("id %q", bcpa.ID))
+	}
+
+	if strings.TrimSpace(bcpa.Owner) == "" {
+		d.Missing = append(d.Missing, "owner")
+	}
+
+	if strings.TrimSpace(bcpa.Use) == "" {
+		d.Missing = append(d.Missing, "use")
+	}
+
+	if m := strings.TrimSpace(bcpa.Milage); m != "" && !digitsOnly.MatchString(m) {
+		d.Implausible = append(d.Implausible, fmt.Sprintf("milage %q", m))
+	}
+
+	if len(bcpa.PropertyAssessments) == 0 {
+		d.Missing = append(d.Missing, SectionAssessments)
+	} else if y := strings.TrimSpace(bcpa.PropertyAssessments[0].Year); !taxYear.MatchString(y) {
+		d.Implausible = append(d.Implausible, fmt.Sprintf("assessment year %q", y))
+	}
+
+	return d, nil
+}
+
+// CheckCard check the card parsed from a building card page has the parcel ID it belongs to
+func CheckCard(doc *goquery.Document, card model.RecBuildingCard, pageURL string, p *Profile) error {
+
+	d := newDrift(doc, PageCard, pageURL, p)
+
+	if id := strings.TrimSpace(card.ParcelIDNumber); id == "" {
+		d.Missing = append(d.Missing, "parcelidnumber")
+	} else if _, err := NormalizeFolio(id); err != nil {
+		d.Implausible = append(d.Implausible, fmt.Sprintf("parcelidnumber %q", id))
+	}
+
+	return settle(d, p)
+}
@@ -0,0 +1,148 @@
+package parse
+
+import (
+	"app/shared/fetch"
+	"app/shared/problem"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordDrift collect the reported drift instead of logging it
+func recordDrift(t *testing.T) *[]Drift {
+
+	reported := []Drift{}
+	saved := ReportDrift
+	ReportDrift = func(d Drift) { reported = append(reported, d) }
+	t.Cleanup(func() { ReportDrift = saved })
+
+	return &reported
+}
+
+func TestFingerprint(t *testing.T) {
+
+	fingerprint := func(name string) string {
+		doc, err := goquery.NewDocumentFromReader(fixture(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Fingerprint(doc)
+	}
+
+	//Different parcels, one layout
+	assert.Equal(t, fingerprint("RecInfo.asp_URL_Folio_504203060330.html"), fingerprint("RecInfo.asp_URL_Folio_494210010020.html"))
+	assert.NotEqual(t, fingerprint("RecInfo.asp_URL_Folio_504203060330.html"), fingerprint("RecBuildingCard.asp_cardno_1_folio_504203060330_taxyear_2018.html"))
+}
+
+func TestCheckParcel(t *testing.T) {
+
+	reported := recordDrift(t)
+
+	doc := parcelPage(t, func(s string) string { return s })
+
+	assert.Nil(t, CheckParcel(doc, LoadParcel(doc, nil), "", nil))
+	assert.Empty(t, *reported)
+}
+
+func TestCheckParcelUnknownFingerprint(t *testing.T) {
+
+	reported := recordDrift(t)
+
+	//The labels still find every field, the new table is only worth a look
+	doc := parcelPage(t, func(s string) string {
+		return strings.Replace(s, "<body>", "<body>\n<table id=\"notice\"><tr><td>Notice: office closed Friday</td></tr></table>", 1)
+	})
+
+	//Nothing to compare with, every page would be unknown
+	assert.Nil(t, CheckParcel(doc, LoadParcel(doc, nil), "", nil))
+	assert.Empty(t, *reported)
+
+	baseline := &Profile{Version: "9.0", Fingerprints: map[string][]string{PageParcel: {Fingerprint(parcelPage(t, func(s string) string { return s }))}}}
+
+	assert.Nil(t, CheckParcel(doc, LoadParcel(doc, baseline), "", baseline))
+
+	if assert.Len(t, *reported, 1) {
+		assert.False(t, (*reported)[0].Known)
+		assert.False(t, (*reported)[0].Broken())
+	}
+}
+
+func TestDriftLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	DriftLogger(&buf)(Drift{Page: PageCard, Fingerprint: "000000000000", Missing: []string{"parcelidnumber"}})
+
+	metric := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &metric))
+	assert.Equal(t, "card", metric["Page"])
+	assert.Equal(t, "true", metric["Broken"])
+	assert.Equal(t, float64(1), metric["LayoutDrift"])
+}
+
+func TestCheckParcelLayoutChanged(t *testing.T) {
+
+	reported := recordDrift(t)
+
+	//Labels renamed and the summary heading dropped, neither the labels nor the shifted selectors find the owner and use
+	doc := parcelPage(t, func(s string) string {
+		s = strings.NewReplacer("Property Owner", "Owner(s)", ">Use<", ">Land Use<", ">Millage<", ">Millage Code<").Replace(s)
+		return strings.Replace(s, `<table width="100%"><tr><td><span class="Header">Property Summary</span></td></tr></table>`, "", 1)
+	})
+
+	err := CheckParcel(doc, LoadParcel(doc, nil), "http://www.bcpa.net/RecInfo.asp?URL_Folio=504203060330", nil)
+
+	var le *LayoutError
+	if assert.ErrorAs(t, err, &le) {
+		assert.Equal(t, []string{"owner", "use"}, le.Drift.Missing)
+		assert.Equal(t, problem.CodeUpstreamLayoutChanged, problem.CodeOf(err))
+	}
+
+	if assert.Len(t, *reported, 1) {
+		assert.True(t, (*reported)[0].Broken())
+		assert.Equal(t, "http://www.bcpa.net/RecInfo.asp?URL_Folio=504203060330", (*reported)[0].URL)
+	}
+}
+
+func TestCheckParcelEmptyPage(t *testing.T) {
+
+	reported := recordDrift(t)
+
+	//An unknown folio gets the parcel page with the values left blank
+	doc := parcelPage(t, func(s string) string {
+		return regexp.MustCompile(`5042 03 06 0330`).ReplaceAllString(s, "")
+	})
+
+	assert.Equal(t, ErrNotFound, CheckParcel(doc, LoadParcel(doc, nil), "", nil))
+	assert.Empty(t, *reported)
+}
+
+func TestLoadBcpaFromFolioLayoutChanged(t *testing.T) {
+
+	recordDrift(t)
+
+	dir, err := ioutil.TempDir("", "bcpa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//A page that is nothing like a parcel page
+	name := "RecInfo.asp_URL_Folio_504203060330.html"
+	if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("<html><head><title>Maintenance</title></head><body><p>Back soon</p></body></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bcpa, err := LoadBcpaFromFolio(context.Background(), fetch.NewFixtures(dir), "504203060330", "http://www.bcpa.net/", nil)
+
+	assert.Equal(t, problem.CodeUpstreamLayoutChanged, problem.CodeOf(err))
+	assert.Empty(t, bcpa.ID)
+}
@@ -0,0 +1,107 @@
+package parse
+
+import (
+	"app/model"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Strategy how a field or section was found on the page
+type Strategy string
+
+// Strategies, tried in this order
+const (
+	// StrategyLabel found by the visible label or heading next to it
+	StrategyLabel Strategy = "label"
+	// StrategySelector found by the absolute selector taken from the browser inspector
+	StrategySelector Strategy = "selector"
+	// StrategyNone not found at all
+	StrategyNone Strategy = "none"
+)
+
+// Visible labels and headings of the parcel page
+const (
+	LabelSiteAddress          = "Site Address"
+	LabelOwner                = "Property Owner"
+	LabelMailingAddress       = "Mailing Address"
+	LabelID                   = "ID #"
+	LabelMillage              = "Millage"
+	LabelUse                  = "Use"
+	LabelLegal                = "Legal Description"
+	HeadingAssessments        = "Property Assessment Values"
+	HeadingExemptions         = "Exemptions and Taxable Values by Taxing Authority"
+	HeadingSales              = "Sales History"
+	HeadingLand               = "Land Calculations"
+	HeadingSpecialAssessments = "Special Assessments"
+)
+
+// cleanLabel the text of a label cell as compared, lower case with the spacing and trailing colon dropped
+func cleanLabel(s string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.Join(strings.Fields(s), " "), ":"))
+}
+
+// LabelCell find the first cell, without cells nested in it, whose whole text is the label
+func LabelCell(doc *goquery.Document, label string) *goquery.Selection {
+
+	label = cleanLabel(label)
+
+	return doc.Find("td, th").FilterFunction(func(i int, s *goquery.Selection) bool {
+		return s.Find("td, th").Size() == 0 && cleanLabel(s.Text()) == label
+	}).First()
+}
+
+// LabelValue the cell following the label cell, the way every field of the parcel page is laid out
+func LabelValue(doc *goquery.Document, label string) *goquery.Selection {
+	return LabelCell(doc, label).Next()
+}
+
+// LabelTable the table a heading cell sits in
+func LabelTable(doc *goquery.Document, heading string) *goquery.Selection {
+	return LabelCell(doc, heading).Closest("table")
+}
+
+// TableRows the rows of a table, leaving out the rows of tables nested in it
+func TableRows(table *goquery.Selection) *goquery.Selection {
+	return table.Find("tr").FilterFunction(func(i int, s *goquery.Selection) bool {
+		return s.Closest("table").IsSelection(table)
+	})
+}
+
+// FindField find a field by its label, falling back to the absolute selector
+func FindField(doc *goquery.Document, label string, selector string) (*goquery.Selection, Strategy) {
+
+	if s := LabelValue(doc, label); strings.TrimSpace(s.Text()) != "" {
+		return s, StrategyLabel
+	}
+
+	if s := doc.Find(selector); s.Size() > 0 {
+		return s, StrategySelector
+	}
+
+	return doc.Find(selector), StrategyNone
+}
+
+// FindSection find the rows of a section table by its heading, falling back to the absolute selector of the rows
+func FindSection(doc *goquery.Document, heading string, rowSelector string) (*goquery.Selection, Strategy) {
+
+	if t := LabelTable(doc, heading); t.Size() > 0 {
+		return TableRows(t), StrategyLabel
+	}
+
+	if rows := doc.Find(rowSelector); rows.Size() > 0 {
+		return rows, StrategySelector
+	}
+
+	return doc.Find(rowSelector), StrategyNone
+}
+
+// SetStrategy record which strategy found a field or section of the record
+func SetStrategy(_bcpa *model.Bcpa, field string, strategy Strategy) {
+
+	if _bcpa.Strategies == nil {
+		_bcpa.Strategies = map[string]string{}
+	}
+
+	_bcpa.Strategies[field] = string(strategy)
+}
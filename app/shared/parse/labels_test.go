@@ -0,0 +1,112 @@
+package parse
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// parcelPage the saved parcel page, rewritten by edit to simulate a layout change
+func parcelPage(t *testing.T, edit func(string) string) *goquery.Document {
+
+	b, err := ioutil.ReadAll(fixture(t, "RecInfo.asp_URL_Folio_504203060330.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(edit(string(b))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func TestLoadParcelByLabel(t *testing.T) {
+
+	bcpa := LoadParcel(parcelPage(t, func(s string) string { return s }), nil)
+
+	for _, field := range []string{"siteaddress", "owner", "id", "legal", SectionAssessments, SectionExemptions, SectionSales, SectionLand, SectionSpecialAssessments} {
+		assert.Equal(t, string(StrategyLabel), bcpa.Strategies[field], field)
+	}
+}
+
+func TestLoadParcelLayoutShift(t *testing.T) {
+
+	//A banner added above everything moves every nth-child selector, the labels still find the values
+	shifted := parcelPage(t, func(s string) string {
+		return strings.Replace(s, "<body>", "<body>\n<table><tr><td>Notice: office closed Friday</td></tr></table>", 1)
+	})
+
+	bcpa := LoadParcel(shifted, nil)
+
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Equal(t, "1234 NE 5 AVENUE FORT LAUDERDALE FL 33304", bcpa.Siteaddress)
+	assert.Len(t, bcpa.PropertyAssessments, 3)
+	assert.Len(t, bcpa.SalesHistory, 2)
+	assert.Equal(t, "2,345", bcpa.LandCalculations.AdjBldgSF)
+	assert.Len(t, bcpa.SpecialAssessments, 1)
+	assert.Equal(t, string(StrategyLabel), bcpa.Strategies[SectionSales])
+}
+
+func TestLoadParcelSelectorFallback(t *testing.T) {
+
+	//Renamed labels, the absolute selectors still match the unchanged layout
+	renamed := parcelPage(t, func(s string) string {
+		return strings.NewReplacer("Property Owner", "Owner(s)", "Sales History", "Recent Sales").Replace(s)
+	})
+
+	bcpa := LoadParcel(renamed, nil)
+
+	assert.Equal(t, "SMITH, JOHN & SMITH, JANE", bcpa.Owner)
+	assert.Equal(t, string(StrategySelector), bcpa.Strategies["owner"])
+	assert.Len(t, bcpa.SalesHistory, 2)
+	assert.Equal(t, string(StrategySelector), bcpa.Strategies[SectionSales])
+	assert.Equal(t, string(StrategyLabel), bcpa.Strategies["id"])
+}
+
+func TestLoadParcelMissingSection(t *testing.T) {
+
+	//The sales table is gone, neither its heading nor its selector finds it
+	doc := parcelPage(t, func(s string) string { return s })
+	LabelTable(doc, HeadingSales).Remove()
+
+	bcpa := LoadParcel(doc, nil)
+
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Empty(t, bcpa.SalesHistory)
+	assert.Equal(t, string(StrategyNone), bcpa.Strategies[SectionSales])
+	if assert.Len(t, bcpa.Errors, 1) {
+		assert.Equal(t, SectionSales, bcpa.Errors[0].Section)
+		assert.Contains(t, bcpa.Errors[0].Cause, HeadingSales)
+	}
+
+	//The other sections still load
+	assert.Len(t, bcpa.PropertyAssessments, 3)
+	assert.Len(t, bcpa.SpecialAssessments, 1)
+}
+
+func TestClassifySearchResultProfile(t *testing.T) {
+
+	//The ID label is renamed and a banner moves every default selector, only the pinned profile finds the folio
+	doc := parcelPage(t, func(s string) string {
+		s = strings.Replace(s, "ID #", "Folio #", 1)
+		return strings.Replace(s, "<body>", "<body>\n<table><tr><td>Notice: office closed Friday</td></tr></table>", 1)
+	})
+
+	outcome, _ := ClassifySearchResult(doc, nil)
+	assert.Equal(t, SearchNotFound, outcome)
+
+	p := &Profile{Version: "test", Parcel: map[string]string{
+		"id": strings.Replace(DefaultProfile.Parcel["id"], "body > table:nth-child(3)", "body > table:nth-child(4)", 1),
+	}}
+
+	outcome, results := ClassifySearchResult(doc, p)
+	assert.Equal(t, SearchSingleHit, outcome)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "504203060330", results[0].Folio)
+	}
+}
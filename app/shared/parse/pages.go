@@ -0,0 +1,114 @@
+package parse
+
+import (
+	"app/model"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Pages the raw HTML of a parcel page and the pages it links to, for parsing without the network
+type Pages struct {
+	Parcel io.Reader
+	// Cards the building card pages in card order
+	Cards []io.Reader
+	// Sketch the Patriot sketch page, optional
+	Sketch io.Reader
+	// BaseURL used to resolve the links found on the pages, optional
+	BaseURL string
+	// Profile the selectors to parse with, optional
+	Profile *Profile
+}
+
+// Warning something on the pages that parsed but doesn't look right
+type Warning struct {
+	Section string `json:"section"`
+	Message string `json:"message"`
+}
+
+// ParsePages build a complete Bcpa record from already fetched pages. Only an unreadable parcel page is an error,
+// sections that fail are recorded in the record's Errors and anything else that looks off is reported as a warning
+func ParsePages(pages Pages) (model.Bcpa, []Warning, error) {
+
+	warnings := []Warning{}
+	warn := func(section string, format string, a ...interface{}) {
+		warnings = append(warnings, Warning{section, fmt.Sprintf(format, a...)})
+	}
+
+	if pages.Parcel == nil {
+		return model.Bcpa{}, warnings, fmt.Errorf("no parcel page")
+	}
+
+	doc, err := goquery.NewDocumentFromReader(pages.Parcel)
+	if err != nil {
+		return model.Bcpa{}, warnings, err
+	}
+
+	bcpa := LoadParcel(doc, pages.Profile)
+
+	//Checked like a live page, but nothing is recorded for the health endpoint or reported as a metric
+	if bcpa.ID == "" {
+		warn(SectionParcel, "no parcel ID found, the page may not be a parcel page")
+	} else if d, err := ParcelDrift(doc, bcpa, "", pages.Profile); err != nil {
+		warn(SectionParcel, "%v", err)
+	} else if d.Broken() {
+		warn(SectionParcel, "%v", &LayoutError{d})
+	} else if d.drifted(pages.Profile) {
+		warn(SectionParcel, "unknown %s page fingerprint %s", d.Page, d.Fingerprint)
+	}
+
+	if linked := len(bcpa.LandCalculations.Cards); linked != len(pages.Cards) {
+		warn("cards", "parcel page links %d card(s) but %d card page(s) were given", linked, len(pages.Cards))
+	}
+
+	for i, r := range pages.Cards {
+
+		//Cards the parcel page didn't link still get parsed
+		if i >= len(bcpa.LandCalculations.Cards) {
+			bcpa.LandCalculations.Cards = append(bcpa.LandCalculations.Cards, model.RecBuildingCard{})
+		}
+
+		LoadSection(&bcpa, CardSection(i), func() error {
+
+			cardDoc, err := goquery.NewDocumentFromReader(r)
+			if err != nil {
+				return err
+			}
+
+			cardURL, _ := url.QueryUnescape(bcpa.LandCalculations.Cards[i].CardURL)
+			LoadCard(cardDoc, cardURL, i, &bcpa, pages.Profile)
+			return nil
+		})
+
+		if bcpa.LandCalculations.Cards[i].ParcelIDNumber == "" {
+			warn(CardSection(i), "no parcel ID found, the page may not be a card page")
+		}
+	}
+
+	if pages.Sketch == nil {
+		if bcpa.LandCalculations.SketchURL != "" {
+			warn(SectionSketch, "parcel page links a sketch but no sketch page was given")
+		}
+		return bcpa, warnings, nil
+	}
+
+	LoadSection(&bcpa, SectionSketch, func() error {
+
+		sketchDoc, err := goquery.NewDocumentFromReader(pages.Sketch)
+		if err != nil {
+			return err
+		}
+
+		sketch := LoadSketch(sketchDoc, bcpa.LandCalculations.SketchURL, pages.BaseURL)
+		bcpa.LandCalculations.Sketch = &sketch
+		return nil
+	})
+
+	if bcpa.LandCalculations.Sketch != nil && len(bcpa.LandCalculations.Sketch.Codes) == 0 {
+		warn(SectionSketch, "no sub-areas found on the sketch page")
+	}
+
+	return bcpa, warnings, nil
+}
@@ -0,0 +1,83 @@
+package parse
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixture(t *testing.T, name string) *os.File {
+	f, err := os.Open(filepath.Join("..", "..", "..", "testdata", "bcpa", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestParsePages(t *testing.T) {
+
+	bcpa, warnings, err := ParsePages(Pages{
+		Parcel:  fixture(t, "RecInfo.asp_URL_Folio_504203060330.html"),
+		Cards:   []io.Reader{fixture(t, "RecBuildingCard.asp_cardno_1_folio_504203060330_taxyear_2018.html")},
+		Sketch:  fixture(t, "RecPatriotSketch.asp_card_1_folio_504203060330_taxyear_2018.html"),
+		BaseURL: "http://www.bcpa.net/",
+	})
+
+	assert.Nil(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Equal(t, "1", bcpa.LandCalculations.Cards[0].CardNo)
+	assert.Len(t, bcpa.LandCalculations.Cards[0].Permits, 2)
+	assert.Len(t, bcpa.LandCalculations.Sketch.Codes, 5)
+}
+
+func TestParsePagesWarnings(t *testing.T) {
+
+	bcpa, warnings, err := ParsePages(Pages{
+		Parcel: fixture(t, "RecInfo.asp_URL_Folio_494210010020.html"),
+		Cards: []io.Reader{
+			fixture(t, "RecBuildingCard.asp_cardno_1_folio_494210010020_taxyear_2018.html"),
+			strings.NewReader("<html><body>Session expired</body></html>"),
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "494210010020", bcpa.ID)
+
+	sections := []string{}
+	for _, w := range warnings {
+		sections = append(sections, w.Section)
+	}
+	assert.Equal(t, []string{"cards", "card 2"}, sections)
+}
+
+func TestParsePagesLeavesHealthAlone(t *testing.T) {
+
+	reported := recordDrift(t)
+	checked, _ := Checks.Counts()
+
+	b, err := ioutil.ReadAll(fixture(t, "RecInfo.asp_URL_Folio_504203060330.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := strings.NewReplacer("Property Owner", "Owner(s)", ">Use<", ">Land Use<").Replace(string(b))
+	broken = strings.Replace(broken, `<table width="100%"><tr><td><span class="Header">Property Summary</span></td></tr></table>`, "", 1)
+
+	_, warnings, err := ParsePages(Pages{Parcel: strings.NewReader(broken)})
+	assert.Nil(t, err)
+
+	if assert.NotEmpty(t, warnings) {
+		assert.Equal(t, SectionParcel, warnings[0].Section)
+		assert.Contains(t, warnings[0].Message, "missing owner, use")
+	}
+
+	//An offline parse is no news about the live site
+	assert.Empty(t, *reported)
+	now, _ := Checks.Counts()
+	assert.Equal(t, checked, now)
+}
@@ -2,26 +2,162 @@ package parse
 
 import (
 	"app/model"
+	"app/shared/fetch"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/url"
+	"path"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
-//LoadBcpaFromDoc used to load Bcpa data from HTML
-func LoadBcpaFromDoc(doc *goquery.Document) model.Bcpa {
+// FolioURL build the parcel detail page URL for a folio number
+func FolioURL(baseURL string, folio string) string {
+	return baseURL + "RecInfo.asp?URL_Folio=" + url.QueryEscape(folio)
+}
+
+var (
+	folioSeparators = regexp.MustCompile(`[\s\-]`)
+	folioDigits     = regexp.MustCompile(`^[0-9]{12}$`)
+)
+
+// NormalizeFolio strip the separators from a folio / parcel ID and make sure we have the 12 digits BCPA expects
+func NormalizeFolio(folio string) (string, error) {
+
+	//Drop the spaces and dashes used when the parcel ID is displayed
+	folio = folioSeparators.ReplaceAllString(folio, "")
+
+	if !folioDigits.MatchString(folio) {
+		return "", fmt.Errorf("invalid folio %q: expected 12 digits", folio)
+	}
+
+	return folio, nil
+}
+
+// LoadBcpaFromFolio fetch the parcel detail page for a folio directly and load the Bcpa data from it
+func LoadBcpaFromFolio(ctx context.Context, f fetch.Fetcher, folio string, baseURL string, p *Profile) (model.Bcpa, error) {
+
+	folio, err := NormalizeFolio(folio)
+	if err != nil {
+		return model.Bcpa{}, err
+	}
+
+	// Load the HTML document from the URL
+	page, err := f.Get(ctx, FolioURL(baseURL, folio))
+	if err != nil {
+		return model.Bcpa{}, err
+	}
+
+	doc, err := page.Document()
+	if err != nil {
+		return model.Bcpa{}, err
+	}
+
+	bcpa := LoadBcpa(ctx, f, page, doc, baseURL, p)
+
+	//Rather no record than a blank one parsed from a page we no longer understand
+	if err = CheckParcel(doc, bcpa, page.URL, p); err != nil {
+		return model.Bcpa{}, err
+	}
+
+	return bcpa, nil
+}
+
+// LoadParcel run every loader against the parcel page, the card and sketch pages are left to the caller.
+// A section that fails is recorded in Errors and the others still load. A nil profile uses the default selectors
+func LoadParcel(doc *goquery.Document, p *Profile) model.Bcpa {
+
+	bcpa := model.Bcpa{}
+
+	//Load the BCPA parent node from the HTML receieved from URL
+	LoadSection(&bcpa, SectionParcel, func() error {
+		bcpa = LoadBcpaFromDoc(doc, p)
+		return nil
+	})
+
+	//Load the BCPA object with with assessments
+	LoadSection(&bcpa, SectionAssessments, func() error {
+		return LoadAppendPropertyAssessments(doc, &bcpa, p)
+	})
+
+	//load exemptions
+	LoadSection(&bcpa, SectionExemptions, func() error {
+		return LoadAppendExemptionsTaxable(doc, &bcpa, p)
+	})
+
+	//Load Sales History
+	LoadSection(&bcpa, SectionSales, func() error {
+		return LoadSalesHistory(doc, &bcpa, p)
+	})
+
+	//Load the Land Calculations
+	LoadSection(&bcpa, SectionLand, func() error {
+		return LoadLandCalculations(doc, &bcpa, p)
+	})
+
+	//Load the Special Assessments
+	LoadSection(&bcpa, SectionSpecialAssessments, func() error {
+		return LoadSpecialAssessments(doc, &bcpa, p)
+	})
+
+	bcpa.Provenance = NewProvenance(p)
+
+	return bcpa
+}
+
+// LoadBcpa run every loader against the parcel page and parse the card and sketch pages it links to.
+// Each card and the sketch succeed or fail on their own, failures are recorded in Errors. Once ctx is done the
+// pages left aren't fetched and the record is returned as it is, marked incomplete
+func LoadBcpa(ctx context.Context, f fetch.Fetcher, page *fetch.Page, doc *goquery.Document, baseURL string, p *Profile) model.Bcpa {
+
+	bcpa := LoadParcel(doc, p)
+	AddSource(&bcpa, SectionParcel, page)
+
+	//Check if we have a URL for the CARD page. If so Parse it for data.
+	//Card pages can link more cards so the list may grow as we go
+	for i := 0; i < len(bcpa.LandCalculations.Cards); i++ {
+
+		LoadSection(&bcpa, CardSection(i), func() error {
+
+			//Grab the URL from the card
+			cardURL, err := url.QueryUnescape(bcpa.LandCalculations.Cards[i].CardURL)
+			if err != nil {
+				return err
+			}
+
+			//Start parseing the page
+			return ExtractCardURL(ctx, f, cardURL, i, &bcpa, baseURL, p)
+		})
+	}
+
+	//Parse the sketch sub-areas so they can be reconciled with the building SF
+	if bcpa.LandCalculations.SketchURL != "" {
+		LoadSection(&bcpa, SectionSketch, func() error {
+			return ExtractSketchURL(ctx, f, bcpa.LandCalculations.SketchURL, &bcpa, baseURL)
+		})
+	}
+
+	return bcpa
+}
+
+// LoadBcpaFromDoc used to load Bcpa data from HTML
+func LoadBcpaFromDoc(doc *goquery.Document, p *Profile) model.Bcpa {
 
 	bcpa := model.Bcpa{}
 	var siteAddress, owner, mailingAddress, id, mileage, use, legal string
 
-	// use selector found with the browser inspector
-	siteAddress = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(1) > table > tbody > tr:nth-child(1) > td:nth-child(2) > span > a > b").Contents().Text()
+	//Find each field by its label, the selectors found with the browser inspector are the fallback
+	var field *goquery.Selection
+	var strategy Strategy
+
+	field, strategy = FindField(doc, LabelSiteAddress, p.Selector(PageParcel, "siteaddress"))
+	siteAddress = field.Contents().Text()
+	SetStrategy(&bcpa, "siteaddress", strategy)
 
 	//clean up the carriage return
 	re := regexp.MustCompile(`\r?\n`)
@@ -30,31 +166,43 @@ func LoadBcpaFromDoc(doc *goquery.Document) model.Bcpa {
 	//Set the Object
 	bcpa.Siteaddress = strings.TrimSpace(StripSpaces(siteAddress))
 
-	owner = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(1) > table > tbody > tr:nth-child(2) > td:nth-child(2) > span").Contents().Text()
+	field, strategy = FindField(doc, LabelOwner, p.Selector(PageParcel, "owner"))
+	owner = field.Contents().Text()
+	SetStrategy(&bcpa, "owner", strategy)
 	//Set the Object
 	bcpa.Owner = strings.TrimSpace(owner)
 
-	mailingAddress = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(1) > table > tbody > tr:nth-child(3) > td:nth-child(2) > span").Contents().Text()
+	field, strategy = FindField(doc, LabelMailingAddress, p.Selector(PageParcel, "mailingAddress"))
+	mailingAddress = field.Contents().Text()
+	SetStrategy(&bcpa, "mailingAddress", strategy)
 
 	//Set the Object
 	bcpa.MailingAddress = strings.TrimSpace(mailingAddress)
 
-	id = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(3) > table > tbody > tr:nth-child(1) > td:nth-child(2) > span").Contents().Text()
+	field, strategy = FindField(doc, LabelID, p.Selector(PageParcel, "id"))
+	id = field.Contents().Text()
+	SetStrategy(&bcpa, "id", strategy)
 
 	//Set the Object
 	bcpa.ID = strings.TrimSpace(strings.Replace(StripSpaces(id), " ", "", -1))
 
-	mileage = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(3) > table > tbody > tr:nth-child(2) > td:nth-child(2) > span").Contents().Text()
+	field, strategy = FindField(doc, LabelMillage, p.Selector(PageParcel, "milage"))
+	mileage = field.Contents().Text()
+	SetStrategy(&bcpa, "milage", strategy)
 
 	//Set the Object
 	bcpa.Milage = strings.TrimSpace(mileage)
 
-	use = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(3) > table > tbody > tr:nth-child(3) > td:nth-child(2) > span").Contents().Text()
+	field, strategy = FindField(doc, LabelUse, p.Selector(PageParcel, "use"))
+	use = field.Contents().Text()
+	SetStrategy(&bcpa, "use", strategy)
 
 	//Set the Object
 	bcpa.Use = strings.TrimSpace(StripSpaces(use))
 
-	legal = doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(4) > tbody > tr > td:nth-child(2) > span").Contents().Text()
+	field, strategy = FindField(doc, LabelLegal, p.Selector(PageParcel, "legal"))
+	legal = field.Contents().Text()
+	SetStrategy(&bcpa, "legal", strategy)
 
 	//Set the Object
 	bcpa.Legal = strings.TrimSpace(legal)
@@ -70,12 +218,11 @@ func MarshalBcpa(bcpa model.Bcpa) string {
 		fmt.Printf("Error: %s", err)
 		return "0"
 	}
-	fmt.Println(string(b))
 
 	return string(b)
 }
 
-//StripSpaces remove leading and trailing and extra gapped spaces
+// StripSpaces remove leading and trailing and extra gapped spaces
 func StripSpaces(o string) string {
 
 	releadclosewhtsp2 := regexp.MustCompile(`^[\s\p{Zs}]+|[\s\p{Zs}]+$`)
@@ -113,10 +260,13 @@ func PropertyAssessmentRecord(s *goquery.Selection) model.PropertyAssessmentValu
 	return p
 }
 
-//LoadAppendPropertyAssessments used to load and append Assessments to the BCPA parent node calls PropertyAssessmentRecord
-func LoadAppendPropertyAssessments(doc *goquery.Document, _bcpa *model.Bcpa) {
+// LoadAppendPropertyAssessments used to load and append Assessments to the BCPA parent node calls PropertyAssessmentRecord
+func LoadAppendPropertyAssessments(doc *goquery.Document, _bcpa *model.Bcpa, p *Profile) error {
+
+	rows, strategy := FindSection(doc, HeadingAssessments, p.Selector(PageParcel, SectionAssessments))
+	SetStrategy(_bcpa, SectionAssessments, strategy)
 
-	doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(6) > tbody > tr").Each(func(i int, s *goquery.Selection) {
+	rows.Each(func(i int, s *goquery.Selection) {
 
 		if i > 1 {
 			pa := PropertyAssessmentRecord(s)
@@ -125,6 +275,7 @@ func LoadAppendPropertyAssessments(doc *goquery.Document, _bcpa *model.Bcpa) {
 		}
 	})
 
+	return missingSection(HeadingAssessments, strategy)
 }
 
 // ExemptionsTaxableRecord  parse exemptions called by LoadAppendExemptionsTaxable
@@ -241,7 +392,7 @@ func ExemptionsTaxableRecord(s *goquery.Selection, i int, eta model.ExemptionsTa
 }
 
 // LoadAppendExemptionsTaxable Load Taxable and Exemptions Calls ExemptionsTaxableRecord
-func LoadAppendExemptionsTaxable(doc *goquery.Document, _bcpa *model.Bcpa) {
+func LoadAppendExemptionsTaxable(doc *goquery.Document, _bcpa *model.Bcpa, p *Profile) error {
 
 	//Preload the object
 	eta := model.ExemptionsTaxableValuesbyTaxingAuthority{}
@@ -251,7 +402,10 @@ func LoadAppendExemptionsTaxable(doc *goquery.Document, _bcpa *model.Bcpa) {
 	eta.Municipal = model.ExemptionsAndTaxableValue{}
 	eta.Independent = model.ExemptionsAndTaxableValue{}
 
-	doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(8) > tbody > tr").Each(func(i int, s *goquery.Selection) {
+	rows, strategy := FindSection(doc, HeadingExemptions, p.Selector(PageParcel, SectionExemptions))
+	SetStrategy(_bcpa, SectionExemptions, strategy)
+
+	rows.Each(func(i int, s *goquery.Selection) {
 
 		if i > 1 {
 			eta = ExemptionsTaxableRecord(s, i, eta)
@@ -259,6 +413,8 @@ func LoadAppendExemptionsTaxable(doc *goquery.Document, _bcpa *model.Bcpa) {
 	})
 
 	_bcpa.ExemptionsTaxable = eta
+
+	return missingSection(HeadingExemptions, strategy)
 }
 
 // SalesRecord Parse Sales hostory table called by LoadSalesHistory
@@ -284,9 +440,12 @@ func SalesRecord(s *goquery.Selection) model.Sale {
 }
 
 // LoadSalesHistory Load up the sales history table in objects and append to BCPA parent calls SalesRecord
-func LoadSalesHistory(doc *goquery.Document, _bcpa *model.Bcpa) {
+func LoadSalesHistory(doc *goquery.Document, _bcpa *model.Bcpa, p *Profile) error {
+
+	rows, strategy := FindSection(doc, HeadingSales, p.Selector(PageParcel, SectionSales))
+	SetStrategy(_bcpa, SectionSales, strategy)
 
-	doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(10) > tbody > tr > td:nth-child(1) > table:nth-child(1) > tbody > tr").Each(func(i int, s *goquery.Selection) {
+	rows.Each(func(i int, s *goquery.Selection) {
 
 		if i > 1 {
 			if len(strings.TrimSpace(StripSpaces(s.Find("td:nth-child(1)").Find("span").First().Contents().Text()))) > 0 {
@@ -297,6 +456,8 @@ func LoadSalesHistory(doc *goquery.Document, _bcpa *model.Bcpa) {
 			}
 		}
 	})
+
+	return missingSection(HeadingSales, strategy)
 }
 
 // LandCalculationRecord extract the land calculation record called by LoadLandCalculations
@@ -320,7 +481,7 @@ func LandCalculationRecord(s *goquery.Selection) model.LandCalculation {
 }
 
 // LoadLandCalculations load calculations structure calls LandCalculationRecord
-func LoadLandCalculations(doc *goquery.Document, _bcpa *model.Bcpa) {
+func LoadLandCalculations(doc *goquery.Document, _bcpa *model.Bcpa, p *Profile) error {
 
 	//Parent node to be attached to BCPA
 	lcs := model.LandCalculations{}
@@ -328,8 +489,11 @@ func LoadLandCalculations(doc *goquery.Document, _bcpa *model.Bcpa) {
 	//We need a Card placeholder as we'll need to set the URL for use later
 	card := model.RecBuildingCard{}
 
+	//Find the table by its heading, the inspector selector is the fallback
+	rows, strategy := FindSection(doc, HeadingLand, p.Selector(PageParcel, SectionLand))
+
 	//Need to know how many rows are in the table. We only need 3-* and the last 2 or 3 rows
-	rowCount := doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(10) > tbody > tr > td:nth-child(2) > table > tbody").Find("tr").Size()
+	rowCount := rows.Size()
 
 	//Last row of table
 	EffActYearBuiltRowIndex := rowCount - 1
@@ -339,7 +503,7 @@ func LoadLandCalculations(doc *goquery.Document, _bcpa *model.Bcpa) {
 	BldgRowIndex := rowCount - 3
 
 	//Lets loop the Table rows
-	doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(10) > tbody > tr > td:nth-child(2) > table > tbody > tr").Each(func(i int, s *goquery.Selection) {
+	rows.Each(func(i int, s *goquery.Selection) {
 
 		if i == EffActYearBuiltRowIndex { //Grab the last row of the table
 
@@ -396,6 +560,12 @@ func LoadLandCalculations(doc *goquery.Document, _bcpa *model.Bcpa) {
 	}
 
 	_bcpa.LandCalculations = lcs
+	SetStrategy(_bcpa, SectionLand, strategy)
+
+	//Parcels with several buildings link a card per building
+	AppendCardLinks(doc, _bcpa)
+
+	return missingSection(HeadingLand, strategy)
 }
 
 // SpecialAssessmentRecord extract data for structure called by LoadSpecialAssessments
@@ -431,10 +601,13 @@ func SpecialAssessmentRecord(s *goquery.Selection) model.SpecialAssessment {
 }
 
 // LoadSpecialAssessments parse assessments table calls SpecialAssessmentRecord
-func LoadSpecialAssessments(doc *goquery.Document, _bcpa *model.Bcpa) {
+func LoadSpecialAssessments(doc *goquery.Document, _bcpa *model.Bcpa, p *Profile) error {
 
 	//Lets loop the Table rows
-	doc.Find("body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(12) > tbody > tr").Each(func(i int, s *goquery.Selection) {
+	rows, strategy := FindSection(doc, HeadingSpecialAssessments, p.Selector(PageParcel, SectionSpecialAssessments))
+	SetStrategy(_bcpa, SectionSpecialAssessments, strategy)
+
+	rows.Each(func(i int, s *goquery.Selection) {
 		if i > 1 {
 
 			specialAssessment := SpecialAssessmentRecord(s)
@@ -442,93 +615,160 @@ func LoadSpecialAssessments(doc *goquery.Document, _bcpa *model.Bcpa) {
 			_bcpa.SpecialAssessments = append(_bcpa.SpecialAssessments, specialAssessment)
 		}
 	})
+
+	return missingSection(HeadingSpecialAssessments, strategy)
 }
 
-//ExtractCardURL Parse the data from the card URL
-func ExtractCardURL(cardURL string, i int, _bcpa *model.Bcpa, _baseURL string) error {
+// ExtractCardURL Parse the data from the card URL
+func ExtractCardURL(ctx context.Context, f fetch.Fetcher, cardURL string, i int, _bcpa *model.Bcpa, _baseURL string, p *Profile) error {
 
 	// Load the HTML document from the URL
-	doc, err := goquery.NewDocument(_baseURL + cardURL)
+	page, err := f.Get(ctx, ResolveURL(_baseURL, cardURL))
+	if err != nil {
+		return err
+	}
 
+	doc, err := page.Document()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	q, errParseQuery := url.Parse(cardURL)
+	LoadCard(doc, cardURL, i, _bcpa, p)
+	AddSource(_bcpa, CardSection(i), page)
+
+	//Pick up the other buildings from the card page navigation
+	AppendCardLinks(doc, _bcpa)
+
+	return CheckCard(doc, _bcpa.LandCalculations.Cards[i], page.URL, p)
+}
+
+// CardLinks find every building card link on a parcel or card page
+func CardLinks(doc *goquery.Document) []string {
+
+	links := []string{}
+
+	doc.Find("a[href*='RecBuildingCard']").Each(func(i int, s *goquery.Selection) {
+		if href, ok := s.Attr("href"); ok && strings.TrimSpace(href) != "" {
+			links = append(links, strings.TrimSpace(href))
+		}
+	})
+
+	return links
+}
+
+// AppendCardLinks add a card placeholder for each card link we don't already have, the URL is escaped like LoadLandCalculations does
+func AppendCardLinks(doc *goquery.Document, _bcpa *model.Bcpa) {
+
+	for _, link := range CardLinks(doc) {
+
+		if HasCard(_bcpa, link) {
+			continue
+		}
+
+		_bcpa.LandCalculations.Cards = append(_bcpa.LandCalculations.Cards, model.RecBuildingCard{CardURL: url.QueryEscape(link)})
+	}
+}
+
+// HasCard check if a card URL already has a card, links to the same card can differ in case and parameter order
+func HasCard(_bcpa *model.Bcpa, cardURL string) bool {
+
+	key := CardKey(cardURL)
+
+	for _, card := range _bcpa.LandCalculations.Cards {
+		existing, err := url.QueryUnescape(card.CardURL)
+		if err == nil && CardKey(existing) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CardKey canonical form of a card URL used to tell cards apart
+func CardKey(cardURL string) string {
+
+	u, err := url.Parse(strings.TrimSpace(cardURL))
 	if err != nil {
-		log.Fatal(errParseQuery)
-	} else { //Since we can parse the URL lets set the values
+		return strings.ToLower(cardURL)
+	}
 
-		//urlParams := q.Query() Pulling the tax year and folio
-		_bcpa.LandCalculations.Cards[i].Folio = q.Query()["folio"][0]
-		_bcpa.LandCalculations.Cards[i].TaxYear = q.Query()["taxyear"][0]
+	//Lower case the keys and let Encode sort them
+	q := url.Values{}
+	for k, v := range u.Query() {
+		q[strings.ToLower(k)] = v
+	}
+
+	return strings.ToLower(path.Base(u.Path)) + "?" + q.Encode()
+}
+
+// LoadCard Parse the data from a card page into the card at index i
+func LoadCard(doc *goquery.Document, cardURL string, i int, _bcpa *model.Bcpa, p *Profile) {
 
+	if q, err := url.Parse(cardURL); err == nil { //Since we can parse the URL lets set the values
+
+		//urlParams := q.Query() Pulling the tax year, folio and card number
+		for k, v := range q.Query() {
+			switch strings.ToLower(k) {
+			case "folio":
+				_bcpa.LandCalculations.Cards[i].Folio = v[0]
+			case "taxyear":
+				_bcpa.LandCalculations.Cards[i].TaxYear = v[0]
+			case "cardno", "card":
+				_bcpa.LandCalculations.Cards[i].CardNo = v[0]
+			}
+		}
 	}
 
 	//Grab the various values
 	//Section 1
-	_bcpa.LandCalculations.Cards[i].ParcelIDNumber = SingleFindValue(doc, "#Table6 > tbody > tr:nth-child(2) > td:nth-child(1)")
+	_bcpa.LandCalculations.Cards[i].ParcelIDNumber = SingleFindValue(doc, p.Selector(PageCard, "parcelidnumber"))
 
 	//Section 2
-	_bcpa.LandCalculations.Cards[i].UseCode = SingleFindValue(doc, "#Table7 > tbody > tr:nth-child(2) > td > p:nth-child(2) > font")
+	_bcpa.LandCalculations.Cards[i].UseCode = SingleFindValue(doc, p.Selector(PageCard, "usecode"))
 
 	//Section 3
-	_bcpa.LandCalculations.Cards[i].NoBedrooms = SingleFindValue(doc, "#Table1 > tbody > tr:nth-child(2) > td:nth-child(1) > p")
-	_bcpa.LandCalculations.Cards[i].NoBaths = SingleFindValue(doc, "#Table1 > tbody > tr:nth-child(2) > td:nth-child(2) > p")
-	_bcpa.LandCalculations.Cards[i].NoUnits = SingleFindValue(doc, "#Table1 > tbody > tr:nth-child(2) > td:nth-child(3) > p")
-	_bcpa.LandCalculations.Cards[i].NoStories = SingleFindValue(doc, "#Table1 > tbody > tr:nth-child(2) > td:nth-child(4) > p")
-	_bcpa.LandCalculations.Cards[i].NoBuildings = SingleFindValue(doc, "#Table1 > tbody > tr:nth-child(2) > td:nth-child(5) > p")
+	_bcpa.LandCalculations.Cards[i].NoBedrooms = SingleFindValue(doc, p.Selector(PageCard, "nobedrooms"))
+	_bcpa.LandCalculations.Cards[i].NoBaths = SingleFindValue(doc, p.Selector(PageCard, "nobaths"))
+	_bcpa.LandCalculations.Cards[i].NoUnits = SingleFindValue(doc, p.Selector(PageCard, "nounits"))
+	_bcpa.LandCalculations.Cards[i].NoStories = SingleFindValue(doc, p.Selector(PageCard, "nostories"))
+	_bcpa.LandCalculations.Cards[i].NoBuildings = SingleFindValue(doc, p.Selector(PageCard, "nobuildings"))
 
 	//Section 4
-	_bcpa.LandCalculations.Cards[i].Foundation = SingleFindValue(doc, "#Table2 > tbody > tr:nth-child(2) > td:nth-child(1) > p")
-	_bcpa.LandCalculations.Cards[i].Exterior = SingleFindValue(doc, "#Table2 > tbody > tr:nth-child(2) > td:nth-child(2) > p")
-	_bcpa.LandCalculations.Cards[i].RoofType = SingleFindValue(doc, "#Table2 > tbody > tr:nth-child(2) > td:nth-child(3) > p")
-	_bcpa.LandCalculations.Cards[i].RoofMaterial = SingleFindValue(doc, "#Table2 > tbody > tr:nth-child(2) > td:nth-child(4) > p")
+	_bcpa.LandCalculations.Cards[i].Foundation = SingleFindValue(doc, p.Selector(PageCard, "foundation"))
+	_bcpa.LandCalculations.Cards[i].Exterior = SingleFindValue(doc, p.Selector(PageCard, "exterior"))
+	_bcpa.LandCalculations.Cards[i].RoofType = SingleFindValue(doc, p.Selector(PageCard, "rooftype"))
+	_bcpa.LandCalculations.Cards[i].RoofMaterial = SingleFindValue(doc, p.Selector(PageCard, "roofmaterial"))
 
 	//Section 5
-	_bcpa.LandCalculations.Cards[i].Interior = SingleFindValue(doc, "#Table3 > tbody > tr:nth-child(2) > td:nth-child(1) > p")
-	_bcpa.LandCalculations.Cards[i].Floors = SingleFindValue(doc, "#Table3 > tbody > tr:nth-child(2) > td:nth-child(2) > p")
-	_bcpa.LandCalculations.Cards[i].Plumbing = SingleFindValue(doc, "#Table3 > tbody > tr:nth-child(2) > td:nth-child(3) > p")
-	_bcpa.LandCalculations.Cards[i].Electric = SingleFindValue(doc, "#Table3 > tbody > tr:nth-child(2) > td:nth-child(4) > p")
-	_bcpa.LandCalculations.Cards[i].Classification = SingleFindValue(doc, "#Table3 > tbody > tr:nth-child(2) > td:nth-child(5) > p")
+	_bcpa.LandCalculations.Cards[i].Interior = SingleFindValue(doc, p.Selector(PageCard, "interior"))
+	_bcpa.LandCalculations.Cards[i].Floors = SingleFindValue(doc, p.Selector(PageCard, "floors"))
+	_bcpa.LandCalculations.Cards[i].Plumbing = SingleFindValue(doc, p.Selector(PageCard, "plumbing"))
+	_bcpa.LandCalculations.Cards[i].Electric = SingleFindValue(doc, p.Selector(PageCard, "electric"))
+	_bcpa.LandCalculations.Cards[i].Classification = SingleFindValue(doc, p.Selector(PageCard, "classification"))
 
 	//Section 6
-	_bcpa.LandCalculations.Cards[i].CeilingHeights = SingleFindValue(doc, "#Table4 > tbody > tr:nth-child(2) > td:nth-child(1) > p")
-	_bcpa.LandCalculations.Cards[i].QualityOfConstruction = SingleFindValue(doc, "#Table4 > tbody > tr:nth-child(2) > td:nth-child(2) > p")
-	_bcpa.LandCalculations.Cards[i].CurrentConditionStructure = SingleFindValue(doc, "#Table4 > tbody > tr:nth-child(2) > td:nth-child(3) > p")
-	_bcpa.LandCalculations.Cards[i].ConstructionClass = SingleFindValue(doc, "#Table4 > tbody > tr:nth-child(2) > td:nth-child(4) > p")
-
-	//fmt.Println(card.ParcelIDNumber)
+	_bcpa.LandCalculations.Cards[i].CeilingHeights = SingleFindValue(doc, p.Selector(PageCard, "ceilingheights"))
+	_bcpa.LandCalculations.Cards[i].QualityOfConstruction = SingleFindValue(doc, p.Selector(PageCard, "qualityofconstruction"))
+	_bcpa.LandCalculations.Cards[i].CurrentConditionStructure = SingleFindValue(doc, p.Selector(PageCard, "currentconditionstructure"))
+	_bcpa.LandCalculations.Cards[i].ConstructionClass = SingleFindValue(doc, p.Selector(PageCard, "constructionclass"))
 
 	//Make sure we have the table
-	if doc.Find("#Table8 > tbody:nth-child(1) > tr").Size() > 0 {
-		fmt.Println("We Have Features")
-
-		LoopCardFeatureTable(doc, i, _bcpa)
-
-	} else {
-		fmt.Println("We DONT Have Features: " + strconv.Itoa(doc.Find("#Table8 > tbody:nth-child(1) > tr").Size()))
+	if doc.Find(p.Selector(PageCard, "features")).Size() > 0 {
+		LoopCardFeatureTable(doc, i, _bcpa, p)
 	}
 
-	//Make sure we have permits
-	if len(doc.Find("#Table5 > tbody:nth-child(1) > tr:nth-child(2) > td:nth-child(1)").Find("p").Contents().Text()) > 2 {
-		fmt.Println("Permits: " + strconv.Itoa(len(doc.Find("#Table5 > tbody:nth-child(1) > tr:nth-child(2) > td:nth-child(1)").Find("p").Contents().Text())))
-		fmt.Println("Permit 1 Val: " + doc.Find("#Table5 > tbody:nth-child(1) > tr:nth-child(2) > td:nth-child(1)").Find("p").Contents().Text())
-
-		LoadCardPermits(doc, i, _bcpa)
-
-	} else {
-		fmt.Println("We DONT Have Permits: " + strconv.Itoa(doc.Find("#Table5 > tbody:nth-child(1) > tr").Size()))
+	//Make sure we have permits, the first row under the header carries the first permit number
+	firstPermit := doc.Find(p.Selector(PageCard, "permits")).Eq(1).Find("td:nth-child(1)").Find("p").Contents().Text()
+	if len(firstPermit) > 2 {
+		LoadCardPermits(doc, i, _bcpa, p)
 	}
-
-	return err
 }
 
 // LoopCardFeatureTable parse the Features table if it exists and return a record set calls ExtractCardURL
-func LoopCardFeatureTable(doc *goquery.Document, i int, _bcpa *model.Bcpa) {
+func LoopCardFeatureTable(doc *goquery.Document, i int, _bcpa *model.Bcpa, p *Profile) {
 	//Lets loop the Table rows
 
-	doc.Find("#Table8 > tbody:nth-child(1) > tr").Each(func(tr int, s *goquery.Selection) {
+	doc.Find(p.Selector(PageCard, "features")).Each(func(tr int, s *goquery.Selection) {
 		if tr > 1 {
 
 			extraFeature := model.ExtraFeature{Feature: strings.TrimSpace(StripSpaces(s.Find("td > p").Contents().Text()))}
@@ -540,11 +780,11 @@ func LoopCardFeatureTable(doc *goquery.Document, i int, _bcpa *model.Bcpa) {
 }
 
 // LoadCardPermits load the permits from the cards page calls ExtractCardURL
-func LoadCardPermits(doc *goquery.Document, i int, _bcpa *model.Bcpa) {
+func LoadCardPermits(doc *goquery.Document, i int, _bcpa *model.Bcpa, p *Profile) {
 
 	permit := model.Permit{}
 
-	doc.Find("#Table5 > tbody > tr").Each(func(tr int, s *goquery.Selection) {
+	doc.Find(p.Selector(PageCard, "permits")).Each(func(tr int, s *goquery.Selection) {
 
 		if tr > 1 {
 
@@ -559,7 +799,7 @@ func LoadCardPermits(doc *goquery.Document, i int, _bcpa *model.Bcpa) {
 	})
 }
 
-//SingleFindValue ...
+// SingleFindValue ...
 func SingleFindValue(doc *goquery.Document, exp string) string {
 	return strings.TrimSpace(StripSpaces(doc.Find(exp).Contents().Text()))
 }
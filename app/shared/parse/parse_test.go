@@ -0,0 +1,109 @@
+package parse
+
+import (
+	"app/model"
+	"app/shared/fetch"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBcpaFromFolioSectionErrors(t *testing.T) {
+
+	//Only the parcel page is available, the card and sketch fetches fail
+	dir, err := ioutil.TempDir("", "bcpa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := "RecInfo.asp_URL_Folio_504203060330.html"
+	body, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "testdata", "bcpa", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, name), body, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bcpa, err := LoadBcpaFromFolio(context.Background(), fetch.NewFixtures(dir), "504203060330", "http://www.bcpa.net/", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Len(t, bcpa.SalesHistory, 2)
+
+	if assert.Len(t, bcpa.Errors, 2) {
+		assert.Equal(t, CardSection(0), bcpa.Errors[0].Section)
+		assert.Equal(t, SectionSketch, bcpa.Errors[1].Section)
+		assert.Contains(t, bcpa.Errors[1].Cause, "RecPatriotSketch.asp")
+	}
+}
+
+// cancelling a fetcher whose lookup is cancelled once the parcel page is in
+type cancelling struct {
+	fetch.Fetcher
+	cancel context.CancelFunc
+}
+
+func (c *cancelling) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+	page, err := c.Fetcher.Get(ctx, rawURL)
+	c.cancel()
+	return page, err
+}
+
+func TestLoadBcpaFromFolioIncomplete(t *testing.T) {
+
+	fixtures := fetch.NewFixtures(filepath.Join("..", "..", "..", "testdata", "bcpa"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bcpa, err := LoadBcpaFromFolio(ctx, &cancelling{Fetcher: fixtures, cancel: cancel}, "504203060330", "http://www.bcpa.net/", nil)
+
+	//The parcel page sections are there, the card and sketch were never fetched
+	assert.Nil(t, err)
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Len(t, bcpa.SalesHistory, 2)
+	assert.True(t, bcpa.Incomplete)
+
+	if assert.Len(t, bcpa.Errors, 2) {
+		assert.Equal(t, CardSection(0), bcpa.Errors[0].Section)
+		assert.Equal(t, context.Canceled.Error(), bcpa.Errors[0].Cause)
+	}
+
+	bcpa, err = LoadBcpaFromFolio(context.Background(), fixtures, "504203060330", "http://www.bcpa.net/", nil)
+	assert.Nil(t, err)
+	assert.False(t, bcpa.Incomplete)
+}
+
+func TestHydrateSearchResultsOneFails(t *testing.T) {
+
+	fixtures := fetch.NewFixtures(filepath.Join("..", "..", "..", "testdata", "bcpa"))
+
+	//The parcel page of the middle result isn't there, the others still load
+	results := []model.ParcelSearchResult{{Folio: "504203060330"}, {Folio: "999999999999"}, {Folio: "494210010020"}}
+	HydrateSearchResults(context.Background(), fixtures, results, "http://www.bcpa.net/", nil)
+
+	assert.Equal(t, "504203060330", results[0].Bcpa.ID)
+	assert.Empty(t, results[0].Error)
+
+	assert.Nil(t, results[1].Bcpa)
+	assert.Contains(t, results[1].Error, "999999999999")
+	assert.False(t, results[1].Incomplete)
+
+	assert.Equal(t, "494210010020", results[2].Bcpa.ID)
+}
+
+func TestNormalizeFolio(t *testing.T) {
+
+	folio, err := NormalizeFolio("5042 03-06 0330")
+	assert.Nil(t, err)
+	assert.Equal(t, "504203060330", folio)
+
+	_, err = NormalizeFolio("5042")
+	assert.NotNil(t, err)
+}
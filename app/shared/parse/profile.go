@@ -0,0 +1,351 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+)
+
+// Page types a profile carries selectors for
+const (
+	PageParcel = "parcel"
+	PageCard   = "card"
+)
+
+// Profile the selectors of each page type. Profiles are versioned files so a layout change on the BCPA site
+// ships as a new profile instead of a rebuild. The parcel page is read by its labels and headings first, the
+// parcel selectors only apply to the fields and sections whose label isn't found. The card page has no labels,
+// its selectors always apply
+type Profile struct {
+	Version string `json:"version" yaml:"version"`
+	// Parcel field and section row selectors of the parcel page, keyed like the record's strategies
+	Parcel map[string]string `json:"parcel" yaml:"parcel"`
+	// Card field and table row selectors of the building card page, keyed by the card's json names
+	Card map[string]string `json:"card" yaml:"card"`
+	// Fingerprints the structure fingerprints of the pages this profile was written for, keyed by page type
+	Fingerprints map[string][]string `json:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+}
+
+// DefaultProfile the selectors found with the browser inspector on the 2018 pages
+var DefaultProfile = &Profile{
+	Version: "2018.1",
+	Parcel: map[string]string{
+		"siteaddress":             "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(1) > table > tbody > tr:nth-child(1) > td:nth-child(2) > span > a > b",
+		"owner":                   "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(1) > table > tbody > tr:nth-child(2) > td:nth-child(2) > span",
+		"mailingAddress":          "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(1) > table > tbody > tr:nth-child(3) > td:nth-child(2) > span",
+		"id":                      "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(3) > table > tbody > tr:nth-child(1) > td:nth-child(2) > span",
+		"milage":                  "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(3) > table > tbody > tr:nth-child(2) > td:nth-child(2) > span",
+		"use":                     "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(2) > tbody > tr > td:nth-child(3) > table > tbody > tr:nth-child(3) > td:nth-child(2) > span",
+		"legal":                   "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(4) > tbody > tr > td:nth-child(2) > span",
+		SectionAssessments:        "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(6) > tbody > tr",
+		SectionExemptions:         "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(8) > tbody > tr",
+		SectionSales:              "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(10) > tbody > tr > td:nth-child(1) > table:nth-child(1) > tbody > tr",
+		SectionLand:               "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(10) > tbody > tr > td:nth-child(2) > table > tbody > tr",
+		SectionSpecialAssessments: "body > table:nth-child(3) > tbody > tr > td > table > tbody > tr:nth-child(1) > td:nth-child(1) > table:nth-child(12) > tbody > tr",
+	},
+	Card: map[string]string{
+		"parcelidnumber":            "#Table6 > tbody > tr:nth-child(2) > td:nth-child(1)",
+		"usecode":                   "#Table7 > tbody > tr:nth-child(2) > td > p:nth-child(2) > font",
+		"nobedrooms":                "#Table1 > tbody > tr:nth-child(2) > td:nth-child(1) > p",
+		"nobaths":                   "#Table1 > tbody > tr:nth-child(2) > td:nth-child(2) > p",
+		"nounits":                   "#Table1 > tbody > tr:nth-child(2) > td:nth-child(3) > p",
+		"nostories":                 "#Table1 > tbody > tr:nth-child(2) > td:nth-child(4) > p",
+		"nobuildings":               "#Table1 > tbody > tr:nth-child(2) > td:nth-child(5) > p",
+		"foundation":                "#Table2 > tbody > tr:nth-child(2) > td:nth-child(1) > p",
+		"exterior":                  "#Table2 > tbody > tr:nth-child(2) > td:nth-child(2) > p",
+		"rooftype":                  "#Table2 > tbody > tr:nth-child(2) > td:nth-child(3) > p",
+		"roofmaterial":              "#Table2 > tbody > tr:nth-child(2) > td:nth-child(4) > p",
+		"interior":                  "#Table3 > tbody > tr:nth-child(2) > td:nth-child(1) > p",
+		"floors":                    "#Table3 > tbody > tr:nth-child(2) > td:nth-child(2) > p",
+		"plumbing":                  "#Table3 > tbody > tr:nth-child(2) > td:nth-child(3) > p",
+		"electric":                  "#Table3 > tbody > tr:nth-child(2) > td:nth-child(4) > p",
+		"classification":            "#Table3 > tbody > tr:nth-child(2) > td:nth-child(5) > p",
+		"ceilingheights":            "#Table4 > tbody > tr:nth-child(2) > td:nth-child(1) > p",
+		"qualityofconstruction":     "#Table4 > tbody > tr:nth-child(2) > td:nth-child(2) > p",
+		"currentconditionstructure": "#Table4 > tbody > tr:nth-child(2) > td:nth-child(3) > p",
+		"constructionclass":         "#Table4 > tbody > tr:nth-child(2) > td:nth-child(4) > p",
+		"features":                  "#Table8 > tbody:nth-child(1) > tr",
+		"permits":                   "#Table5 > tbody > tr",
+	},
+	//No fingerprints until they're taken from captured BCPA pages, the test pages are hand-made
+}
+
+// Selector the selector of a field, a nil profile or a field the profile leaves out uses the default profile
+func (p *Profile) Selector(page string, field string) string {
+
+	if p != nil {
+		if s, ok := p.selectors(page)[field]; ok && s != "" {
+			return s
+		}
+	}
+
+	return DefaultProfile.selectors(page)[field]
+}
+
+// PageFingerprints the fingerprints a profile knows for a page type, a nil profile or a page it leaves out uses the default profile
+func (p *Profile) PageFingerprints(page string) []string {
+
+	if p != nil {
+		if fps := p.Fingerprints[page]; len(fps) > 0 {
+			return fps
+		}
+	}
+
+	return DefaultProfile.Fingerprints[page]
+}
+
+// selectors the selectors of a page type
+func (p *Profile) selectors(page string) map[string]string {
+	switch page {
+	case PageParcel:
+		return p.Parcel
+	case PageCard:
+		return p.Card
+	}
+	return nil
+}
+
+// Check make sure every field is one we know and every selector compiles
+func (p *Profile) Check() error {
+
+	if strings.TrimSpace(p.Version) == "" {
+		return fmt.Errorf("profile has no version")
+	}
+
+	for _, page := range []string{PageParcel, PageCard} {
+		for field, selector := range p.selectors(page) {
+
+			if _, ok := DefaultProfile.selectors(page)[field]; !ok {
+				return fmt.Errorf("profile %s: unknown %s field %q", p.Version, page, field)
+			}
+
+			if err := compiles(selector); err != nil {
+				return fmt.Errorf("profile %s: %s field %q: %v", p.Version, page, field, err)
+			}
+		}
+	}
+
+	for page := range p.Fingerprints {
+		if page != PageParcel && page != PageCard {
+			return fmt.Errorf("profile %s: fingerprints of unknown page %q", p.Version, page)
+		}
+	}
+
+	return nil
+}
+
+// compiles check a selector parses, goquery panics on one that doesn't
+func compiles(selector string) (err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid selector %q: %v", selector, r)
+		}
+	}()
+
+	(&goquery.Document{Selection: &goquery.Selection{}}).Find(selector)
+
+	return nil
+}
+
+// ReadProfile read a profile from a .json, .yaml or .yml file
+func ReadProfile(name string) (*Profile, error) {
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, p)
+	default:
+		err = json.Unmarshal(b, p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	if err = p.Check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return p, nil
+}
+
+// Profiles the profiles that can be picked by version, the default answers requests that don't pin one
+type Profiles struct {
+	Default  *Profile
+	versions map[string]*Profile
+}
+
+// NewProfiles a set holding the default profile only
+func NewProfiles() *Profiles {
+	return &Profiles{Default: DefaultProfile, versions: map[string]*Profile{DefaultProfile.Version: DefaultProfile}}
+}
+
+// Add a profile, the highest version becomes the default
+func (ps *Profiles) Add(p *Profile) {
+
+	ps.versions[p.Version] = p
+
+	if CompareVersions(p.Version, ps.Default.Version) > 0 {
+		ps.Default = p
+	}
+}
+
+// CompareVersions order dotted versions like 2018.2 and 2018.10 part by part, numbers by value and the rest as text
+func CompareVersions(a string, b string) int {
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(as) && i < len(bs); i++ {
+
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+
+		switch {
+		case aerr == nil && berr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aerr != nil || berr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+
+	return len(as) - len(bs)
+}
+
+// Get the profile of a version, the default for ""
+func (ps *Profiles) Get(version string) (*Profile, error) {
+
+	if version == "" {
+		return ps.Default, nil
+	}
+
+	if p, ok := ps.versions[version]; ok {
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("unknown profile %q, expected one of %s", version, strings.Join(ps.Versions(), ", "))
+}
+
+// Versions the versions of the profiles, oldest first
+func (ps *Profiles) Versions() []string {
+
+	versions := []string{}
+	for v := range ps.versions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) < 0 })
+
+	return versions
+}
+
+// LoadProfiles load a profile file, or every .json, .yaml and .yml file of a directory, next to the default profile
+func LoadProfiles(path string) (*Profiles, error) {
+
+	ps := NewProfiles()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{path}
+
+	if info.IsDir() {
+		names = []string{}
+		for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, matches...)
+		}
+	}
+
+	for _, name := range names {
+		p, err := ReadProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		ps.Add(p)
+	}
+
+	return ps, nil
+}
+
+// ValidateProfile check each selector of a profile matches on at least one of the saved pages of its page type
+// in dir, parcel pages are the RecInfo.asp files and card pages the RecBuildingCard.asp files
+func ValidateProfile(p *Profile, dir string) []error {
+
+	errs := []error{}
+
+	for _, pt := range []struct {
+		page    string
+		pattern string
+	}{
+		{PageParcel, "RecInfo.asp*.html"},
+		{PageCard, "RecBuildingCard.asp*.html"},
+	} {
+		names, err := filepath.Glob(filepath.Join(dir, pt.pattern))
+		if err != nil {
+			return append(errs, err)
+		}
+		if len(names) == 0 {
+			errs = append(errs, fmt.Errorf("no %s pages in %s to validate against", pt.page, dir))
+			continue
+		}
+
+		docs := []*goquery.Document{}
+		for _, name := range names {
+			f, err := os.Open(name)
+			if err != nil {
+				return append(errs, err)
+			}
+			doc, err := goquery.NewDocumentFromReader(f)
+			f.Close()
+			if err != nil {
+				return append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+			docs = append(docs, doc)
+		}
+
+		fields := []string{}
+		for field := range DefaultProfile.selectors(pt.page) {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			selector := p.Selector(pt.page, field)
+
+			matched := false
+			for _, doc := range docs {
+				if doc.Find(selector).Size() > 0 {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				errs = append(errs, fmt.Errorf("profile %s: %s field %q matches none of the %d saved page(s)", p.Version, pt.page, field, len(docs)))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,86 @@
+package parse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pagesDir = filepath.Join("..", "..", "..", "testdata", "bcpa")
+
+func TestShippedProfiles(t *testing.T) {
+
+	ps, err := LoadProfiles(filepath.Join("..", "..", "..", "profiles"))
+	assert.Nil(t, err)
+
+	//The shipped copy of the built-in profile must not drift from it
+	p, err := ps.Get(DefaultProfile.Version)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultProfile.Parcel, p.Parcel)
+	assert.Equal(t, DefaultProfile.Card, p.Card)
+	assert.Equal(t, DefaultProfile.Fingerprints, p.Fingerprints)
+
+	for _, version := range ps.Versions() {
+		p, _ := ps.Get(version)
+		assert.Empty(t, ValidateProfile(p, pagesDir), version)
+	}
+}
+
+func TestValidateProfileBrokenSelector(t *testing.T) {
+
+	p := &Profile{Version: "9.0", Card: map[string]string{"nobaths": "#Table99 td"}}
+
+	errs := ValidateProfile(p, pagesDir)
+
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), `card field "nobaths"`)
+}
+
+func TestReadProfileRejectsUnknownField(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "profiles")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "bad.yaml")
+	assert.Nil(t, ioutil.WriteFile(name, []byte("version: \"3\"\nparcel:\n  ownr: span\n"), 0644))
+
+	_, err = ReadProfile(name)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `unknown parcel field "ownr"`)
+}
+
+func TestProfilesPinAndDefault(t *testing.T) {
+
+	ps := NewProfiles()
+	ps.Add(&Profile{Version: "2018.10"})
+	ps.Add(&Profile{Version: "2018.9"})
+
+	assert.Equal(t, "2018.10", ps.Default.Version)
+	assert.Equal(t, []string{"2018.1", "2018.9", "2018.10"}, ps.Versions())
+
+	p, err := ps.Get("2018.9")
+	assert.Nil(t, err)
+	assert.Equal(t, "2018.9", p.Version)
+
+	_, err = ps.Get("1999")
+	assert.True(t, strings.Contains(err.Error(), "expected one of 2018.1, 2018.9, 2018.10"))
+}
+
+func TestLoadParcelPinnedProfile(t *testing.T) {
+
+	//Labels renamed so the selectors are used, a profile pointing owner at the mailing address shows it's the one in use
+	renamed := parcelPage(t, func(s string) string {
+		return strings.NewReplacer("Property Owner", "Owner(s)").Replace(s)
+	})
+
+	p := &Profile{Version: "debug", Parcel: map[string]string{"owner": DefaultProfile.Parcel["mailingAddress"]}}
+
+	assert.Equal(t, "SMITH, JOHN & SMITH, JANE", LoadParcel(renamed, nil).Owner)
+	assert.NotEqual(t, "SMITH, JOHN & SMITH, JANE", LoadParcel(renamed, p).Owner)
+	assert.Equal(t, LoadParcel(renamed, p).MailingAddress, LoadParcel(renamed, p).Owner)
+}
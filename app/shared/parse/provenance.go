@@ -0,0 +1,62 @@
+package parse
+
+import (
+	"app/model"
+	"app/shared/fetch"
+	"runtime/debug"
+)
+
+// ParserVersion the build of the parser recorded on every record. Set it with
+// -ldflags "-X app/shared/parse.ParserVersion=..." or it's taken from the VCS revision go build stamps
+var ParserVersion = buildVersion()
+
+// buildVersion the VCS revision of the binary, dev when go build didn't stamp one
+func buildVersion() string {
+
+	version, dirty := "dev", false
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				version = s.Value
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+	}
+
+	if dirty {
+		version += "-dirty"
+	}
+
+	return version
+}
+
+// ProfileVersion the version of the profile a record is parsed with, the default profile's for nil
+func ProfileVersion(p *Profile) string {
+	if p == nil {
+		return DefaultProfile.Version
+	}
+	return p.Version
+}
+
+// NewProvenance the provenance of a record parsed with a profile, before any page is added
+func NewProvenance(p *Profile) *model.Provenance {
+	return &model.Provenance{ParserVersion: ParserVersion, ProfileVersion: ProfileVersion(p)}
+}
+
+// AddSource record a page the record was built from
+func AddSource(_bcpa *model.Bcpa, section string, page *fetch.Page) {
+
+	if _bcpa.Provenance == nil {
+		_bcpa.Provenance = NewProvenance(nil)
+	}
+
+	_bcpa.Provenance.Sources = append(_bcpa.Provenance.Sources, model.Source{
+		Section:   section,
+		URL:       page.URL,
+		FetchedAt: page.FetchedAt,
+		SHA256:    page.SHA256(),
+	})
+}
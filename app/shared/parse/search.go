@@ -0,0 +1,151 @@
+package parse
+
+import (
+	"app/model"
+	"app/shared/fetch"
+	"app/shared/problem"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// SearchOutcome what kind of page a search landed on
+type SearchOutcome int
+
+const (
+	// SearchNotFound the search matched no parcel
+	SearchNotFound SearchOutcome = iota
+	// SearchSingleHit the search landed on a parcel page
+	SearchSingleHit
+	// SearchCandidates the search matched several parcels and BCPA asks to choose
+	SearchCandidates
+)
+
+// ErrNotFound returned when a search matched no parcel
+var ErrNotFound = problem.New(problem.CodeNotFound, "no parcel matched the search")
+
+// String name of the outcome
+func (o SearchOutcome) String() string {
+	switch o {
+	case SearchSingleHit:
+		return "single"
+	case SearchCandidates:
+		return "candidates"
+	}
+	return "notfound"
+}
+
+// ClassifySearchResult work out if the page a search landed on is a parcel, a list of candidates or nothing at all.
+// A single hit comes back as one result built from the parcel page, read with the profile the lookup uses
+func ClassifySearchResult(doc *goquery.Document, p *Profile) (SearchOutcome, []model.ParcelSearchResult) {
+
+	//A parcel page always carries the parcel ID
+	if bcpa := LoadBcpaFromDoc(doc, p); bcpa.ID != "" {
+		return SearchSingleHit, []model.ParcelSearchResult{{
+			Folio:       bcpa.ID,
+			Owner:       bcpa.Owner,
+			Siteaddress: bcpa.Siteaddress,
+			Use:         bcpa.Use,
+		}}
+	}
+
+	if results := LoadSearchResults(doc); len(results) > 0 {
+		return SearchCandidates, results
+	}
+
+	return SearchNotFound, nil
+}
+
+// SearchResultRecord extract one row of the search results grid called by LoadSearchResults
+func SearchResultRecord(s *goquery.Selection) model.ParcelSearchResult {
+	r := model.ParcelSearchResult{}
+
+	//The folio is carried by the link to the parcel page
+	if href, ok := s.Find("a[href*='URL_Folio']").First().Attr("href"); ok {
+		if q, err := url.Parse(href); err == nil {
+			r.Folio = strings.TrimSpace(q.Query().Get("URL_Folio"))
+		}
+	}
+
+	s.Find("td").Each(func(int int, s *goquery.Selection) {
+
+		switch int {
+		case 0:
+			//Fall back to the cell text if the link didn't give us the folio
+			if r.Folio == "" {
+				r.Folio = strings.Replace(StripSpaces(s.Text()), " ", "", -1)
+			}
+		case 1:
+			r.Owner = strings.TrimSpace(StripSpaces(s.Text()))
+		case 2:
+			r.Siteaddress = strings.TrimSpace(StripSpaces(s.Text()))
+		case 3:
+			r.Use = strings.TrimSpace(StripSpaces(s.Text()))
+		}
+	})
+
+	return r
+}
+
+// LoadSearchResults parse the search results grid, one record per parcel link calls SearchResultRecord
+func LoadSearchResults(doc *goquery.Document) []model.ParcelSearchResult {
+
+	results := []model.ParcelSearchResult{}
+	seen := map[string]bool{}
+
+	//Every result row links to the parcel page, header and paging rows don't
+	doc.Find("tr").Has("a[href*='URL_Folio']").Each(func(i int, s *goquery.Selection) {
+
+		//Skip the rows wrapping a nested results table
+		if s.Find("tr").Size() > 0 {
+			return
+		}
+
+		r := SearchResultRecord(s)
+
+		if r.Folio != "" && !seen[r.Folio] {
+			seen[r.Folio] = true
+			results = append(results, r)
+		}
+	})
+
+	return results
+}
+
+// HydrateSearchResults load the full Bcpa record for each search result. A parcel that fails to load keeps its
+// error instead of a record, the others still load. Once ctx is done the results left are marked incomplete and
+// returned without their record
+func HydrateSearchResults(ctx context.Context, f fetch.Fetcher, results []model.ParcelSearchResult, baseURL string, p *Profile) {
+
+	for i := range results {
+
+		bcpa, err := LoadBcpaFromFolio(ctx, f, results[i].Folio, baseURL, p)
+		if GaveUp(err) {
+			for j := i; j < len(results); j++ {
+				results[j].Incomplete = true
+			}
+			return
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].Bcpa = &bcpa
+	}
+}
+
+// MarshalSearchResults Convert search results to string
+func MarshalSearchResults(results []model.ParcelSearchResult) string {
+	b, err := json.Marshal(results)
+	if err != nil {
+		fmt.Printf("Error: %s", err)
+		return "0"
+	}
+
+	return string(b)
+}
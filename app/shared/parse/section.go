@@ -0,0 +1,78 @@
+package parse
+
+import (
+	"app/model"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Sections of a record that load, and fail, on their own
+const (
+	SectionParcel             = "parcel"
+	SectionAssessments        = "assessments"
+	SectionExemptions         = "exemptions"
+	SectionSales              = "sales"
+	SectionLand               = "land"
+	SectionSpecialAssessments = "specialassessments"
+	SectionSketch             = "sketch"
+)
+
+// SectionPage the section of the page a section is parsed from, the parcel page carries several
+func SectionPage(section string) string {
+
+	switch section {
+	case SectionAssessments, SectionExemptions, SectionSales, SectionLand, SectionSpecialAssessments:
+		return SectionParcel
+	}
+
+	return section
+}
+
+// CardSection section name of the card at index i
+func CardSection(i int) string {
+	return fmt.Sprintf("card %d", i+1)
+}
+
+// LoadSection run a loader and record its failure on the record instead of taking the whole lookup down.
+// A loader that panics on an unexpected page is recorded the same way
+func LoadSection(_bcpa *model.Bcpa, section string, load func() error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			AddSectionError(_bcpa, section, fmt.Errorf("%v", r))
+		}
+	}()
+
+	if err := load(); err != nil {
+		AddSectionError(_bcpa, section, err)
+
+		//Not broken, the lookup ran out of time before it got to the section
+		if GaveUp(err) {
+			_bcpa.Incomplete = true
+		}
+	}
+}
+
+// GaveUp an error from a lookup that was cancelled or ran past its deadline
+func GaveUp(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ErrSectionNotFound a section table neither its heading nor its selector found on the page
+var ErrSectionNotFound = errors.New("section table not found")
+
+// missingSection the error of a section loader whose table wasn't found, nil when it was
+func missingSection(heading string, strategy Strategy) error {
+
+	if strategy == StrategyNone {
+		return fmt.Errorf("%s: %w", heading, ErrSectionNotFound)
+	}
+
+	return nil
+}
+
+// AddSectionError record a failed section on the record
+func AddSectionError(_bcpa *model.Bcpa, section string, err error) {
+	_bcpa.Errors = append(_bcpa.Errors, model.SectionError{Section: section, Cause: err.Error()})
+}
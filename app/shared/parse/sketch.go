@@ -0,0 +1,130 @@
+package parse
+
+import (
+	"app/model"
+	"app/shared/fetch"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// SketchCodeRecord extract one sub-area row of the sketch table called by LoadSketch
+func SketchCodeRecord(s *goquery.Selection) model.PatriotSketchCode {
+	code := model.PatriotSketchCode{}
+
+	s.Find("td").Each(func(int int, s *goquery.Selection) {
+
+		switch int {
+		case 0:
+			code.Code = strings.TrimSpace(StripSpaces(s.Text()))
+		case 1:
+			code.Description = strings.TrimSpace(StripSpaces(s.Text()))
+		case 2:
+			code.Area = strings.TrimSpace(StripSpaces(s.Text()))
+		case 3:
+			code.Factor = strings.TrimSpace(StripSpaces(s.Text()))
+		case 4:
+			code.AdjArea = strings.TrimSpace(StripSpaces(s.Text()))
+		case 5:
+			code.Stories = strings.TrimSpace(StripSpaces(s.Text()))
+		}
+	})
+
+	return code
+}
+
+// LoadSketch parse the Patriot sketch page, the sub-areas table, the image and the adjusted area total calls SketchCodeRecord
+func LoadSketch(doc *goquery.Document, sketchURL string, baseURL string) model.RecPatriotSketch {
+
+	sketch := model.RecPatriotSketch{URL: sketchURL}
+
+	//The sketch and building numbers are carried by the page URL
+	if q, err := url.Parse(sketchURL); err == nil {
+		for k, v := range q.Query() {
+			switch strings.ToLower(k) {
+			case "sketch", "sketchno":
+				sketch.Sketch = v[0]
+			case "building", "bldg", "card", "cardno":
+				sketch.Building = v[0]
+			}
+		}
+	}
+
+	//Grab the sketch image
+	if src, ok := doc.Find("img[src*='ketch'], img[src*='KETCH']").First().Attr("src"); ok {
+		sketch.SketchImgURL = ResolveURL(baseURL, src)
+	}
+
+	//The sub-areas table is the one headed by Code and Description
+	doc.Find("table").FilterFunction(func(i int, t *goquery.Selection) bool {
+		header := strings.ToLower(t.Find("tr").First().Text())
+		return strings.Contains(header, "code") && strings.Contains(header, "description") && t.Find("table").Size() == 0
+	}).First().Find("tr").Each(func(i int, s *goquery.Selection) {
+
+		//Skip the header row
+		if i == 0 {
+			return
+		}
+
+		first := strings.TrimSpace(StripSpaces(s.Find("td").First().Text()))
+
+		if strings.Contains(strings.ToLower(first), "total") {
+			//The total row carries the adjusted area in the same column as the sub-areas
+			sketch.AdjAreaTotal = strings.TrimSpace(StripSpaces(s.Find("td:nth-child(5)").Text()))
+			if sketch.AdjAreaTotal == "" {
+				sketch.AdjAreaTotal = strings.TrimSpace(StripSpaces(s.Find("td").Last().Text()))
+			}
+		} else if first != "" {
+			sketch.Codes = append(sketch.Codes, SketchCodeRecord(s))
+		}
+	})
+
+	return sketch
+}
+
+// ExtractSketchURL Parse the sketch page linked from the land calculations and attach it to the BCPA parent node
+func ExtractSketchURL(ctx context.Context, f fetch.Fetcher, sketchURL string, _bcpa *model.Bcpa, _baseURL string) error {
+
+	sketchURL = ResolveURL(_baseURL, sketchURL)
+
+	// Load the HTML document from the URL
+	page, err := f.Get(ctx, sketchURL)
+	if err != nil {
+		return err
+	}
+
+	doc, err := page.Document()
+	if err != nil {
+		return err
+	}
+
+	sketch := LoadSketch(doc, sketchURL, _baseURL)
+	_bcpa.LandCalculations.Sketch = &sketch
+	AddSource(_bcpa, SectionSketch, page)
+
+	//An error or maintenance page instead of the sketch
+	if len(sketch.Codes) == 0 && sketch.SketchImgURL == "" {
+		return fmt.Errorf("%s has no sketch image or sub-areas", page.URL)
+	}
+
+	return nil
+}
+
+// ResolveURL resolve a link found on a BCPA page against the base URL
+func ResolveURL(baseURL string, ref string) string {
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return ref
+	}
+
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+
+	return base.ResolveReference(u).String()
+}
@@ -0,0 +1,154 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ContentType media type of a problem body, RFC 7807
+const ContentType = "application/problem+json"
+
+// Code stable machine readable error code clients can switch on
+type Code string
+
+// The error catalogue
+const (
+	CodeValidation            Code = "validation"
+	CodeNotFound              Code = "not_found"
+	CodeAmbiguousMatch        Code = "ambiguous_match"
+	CodeUpstreamUnavailable   Code = "upstream_unavailable"
+	CodeUpstreamLayoutChanged Code = "upstream_layout_changed"
+	CodeTimeout               Code = "timeout"
+	CodeClientClosed          Code = "client_closed"
+	CodeInternal              Code = "internal"
+)
+
+// StatusClientClosed the client hung up before the answer, nginx's 499 since HTTP has no status for it
+const StatusClientClosed = 499
+
+// entry HTTP status and title of a catalogue code
+type entry struct {
+	Status int
+	Title  string
+}
+
+var catalogue = map[Code]entry{
+	CodeValidation:            {http.StatusBadRequest, "The request parameters are invalid"},
+	CodeNotFound:              {http.StatusNotFound, "No parcel matched the search"},
+	CodeAmbiguousMatch:        {http.StatusConflict, "Several parcels matched the search"},
+	CodeUpstreamUnavailable:   {http.StatusBadGateway, "The BCPA site is unavailable"},
+	CodeUpstreamLayoutChanged: {http.StatusBadGateway, "The BCPA page layout has changed"},
+	CodeTimeout:               {http.StatusGatewayTimeout, "The BCPA site did not answer in time"},
+	CodeClientClosed:          {StatusClientClosed, "The client closed the request"},
+	CodeInternal:              {http.StatusInternalServerError, "Internal error"},
+}
+
+// Status HTTP status of the code
+func (c Code) Status() int {
+	if e, ok := catalogue[c]; ok {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Title short human readable summary of the code
+func (c Code) Title() string {
+	if e, ok := catalogue[c]; ok {
+		return e.Title
+	}
+	return catalogue[CodeInternal].Title
+}
+
+// Type URI identifying the problem type
+func (c Code) Type() string {
+	return "urn:bcpa:problem:" + string(c)
+}
+
+// Error an error carrying its catalogue code, returned by the library so callers don't have to guess
+type Error struct {
+	Code   Code
+	Detail string
+	Err    error
+}
+
+// New create an error for a catalogue code
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Wrap create an error for a catalogue code around the cause
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Detail: err.Error(), Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// Unwrap the cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CodeOf catalogue code of an error. Errors that don't carry one are upstream failures, told apart from timeouts
+// and from a client that hung up
+func CodeOf(err error) Code {
+
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe.Code
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return CodeClientClosed
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeTimeout
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return CodeTimeout
+	}
+
+	return CodeUpstreamUnavailable
+}
+
+// Problem RFC 7807 problem details body
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     Code   `json:"code"`
+	// Parameter the request parameter at fault, for validation problems
+	Parameter string `json:"parameter,omitempty"`
+	// Candidates the parcels to choose from, for ambiguous matches
+	Candidates interface{} `json:"candidates,omitempty"`
+}
+
+// NewProblem build the problem body for a catalogue code
+func NewProblem(code Code, detail string) Problem {
+	return Problem{
+		Type:   code.Type(),
+		Title:  code.Title(),
+		Status: code.Status(),
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// FromError build the problem body for an error
+func FromError(err error) Problem {
+	return NewProblem(CodeOf(err), err.Error())
+}
+
+// Marshal Convert the problem to its JSON body
+func (p Problem) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
@@ -0,0 +1,26 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeOf(t *testing.T) {
+
+	for err, code := range map[error]Code{
+		New(CodeNotFound, "no parcel"):                            CodeNotFound,
+		fmt.Errorf("folio: %w", New(CodeValidation, "bad folio")): CodeValidation,
+		context.Canceled: CodeClientClosed,
+		fmt.Errorf("card 1: %w", context.DeadlineExceeded): CodeTimeout,
+		errors.New("connection refused"):                   CodeUpstreamUnavailable,
+	} {
+		assert.Equal(t, code, CodeOf(err), err.Error())
+	}
+
+	assert.Equal(t, 499, CodeClientClosed.Status())
+	assert.Equal(t, 504, CodeTimeout.Status())
+}
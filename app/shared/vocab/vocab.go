@@ -0,0 +1,281 @@
+package vocab
+
+import (
+	"app/shared/fetch"
+	"app/shared/lookup"
+	"app/shared/parse"
+	"app/shared/problem"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// The RecAddr.asp dropdowns
+const (
+	FieldStreetDirection = "Situs_Street_Direction"
+	FieldStreetType      = "Situs_Street_Type"
+	FieldPostDirection   = "Situs_Street_Post_Dir"
+	FieldCity            = "Situs_City"
+)
+
+// Option one entry of a dropdown, the value the form posts and the name shown for it
+type Option struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// Vocabularies the option lists of the address search form
+type Vocabularies struct {
+	StreetDirections []Option  `json:"streetDirections"`
+	StreetTypes      []Option  `json:"streetTypes"`
+	PostDirections   []Option  `json:"postDirections"`
+	Cities           []Option  `json:"cities"`
+	FetchedAt        time.Time `json:"fetchedAt"`
+}
+
+// Lists the vocabularies by the name the metadata endpoints use
+func (v Vocabularies) Lists() map[string][]Option {
+	return map[string][]Option{
+		"street-directions": v.StreetDirections,
+		"street-types":      v.StreetTypes,
+		"post-directions":   v.PostDirections,
+		"cities":            v.Cities,
+	}
+}
+
+// CityCodes city codes keyed by upper case city name, what the address parser matches against
+func (v Vocabularies) CityCodes() map[string]string {
+
+	codes := map[string]string{}
+	for _, o := range v.Cities {
+		name := strings.ToUpper(strings.Replace(o.Label, "-", " ", -1))
+		codes[strings.Join(strings.Fields(name), " ")] = o.Value
+	}
+
+	return codes
+}
+
+// LoadOptions read the options of the named dropdown, the blank "any" entry is left out
+func LoadOptions(doc *goquery.Document, name string) []Option {
+
+	options := []Option{}
+
+	doc.Find("select[name='" + name + "'] option").Each(func(i int, s *goquery.Selection) {
+
+		value, ok := s.Attr("value")
+		if !ok {
+			value = s.Text()
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+
+		options = append(options, Option{Value: value, Label: strings.TrimSpace(parse.StripSpaces(s.Text()))})
+	})
+
+	return options
+}
+
+// LoadVocabularies read the dropdowns of the RecAddr.asp page
+func LoadVocabularies(doc *goquery.Document) Vocabularies {
+	return Vocabularies{
+		StreetDirections: LoadOptions(doc, FieldStreetDirection),
+		StreetTypes:      LoadOptions(doc, FieldStreetType),
+		PostDirections:   LoadOptions(doc, FieldPostDirection),
+		Cities:           LoadOptions(doc, FieldCity),
+	}
+}
+
+// Harvest fetch RecAddr.asp and read its dropdowns
+func Harvest(ctx context.Context, f fetch.Fetcher, baseURL string) (Vocabularies, error) {
+
+	page, err := f.Get(ctx, baseURL+"RecAddr.asp")
+	if err != nil {
+		return Vocabularies{}, err
+	}
+
+	doc, err := page.Document()
+	if err != nil {
+		return Vocabularies{}, problem.Wrap(problem.CodeUpstreamLayoutChanged, err)
+	}
+
+	v := LoadVocabularies(doc)
+	v.FetchedAt = page.FetchedAt
+
+	if len(v.StreetTypes) == 0 && len(v.Cities) == 0 {
+		return Vocabularies{}, problem.New(problem.CodeUpstreamLayoutChanged, "no street type or city options on RecAddr.asp")
+	}
+
+	return v, nil
+}
+
+// DefaultBackoff how long a failed harvest is remembered before the site is tried again
+const DefaultBackoff = 30 * time.Second
+
+// Cache keeps the harvested vocabularies, the dropdowns change a few times a year at most
+type Cache struct {
+	TTL time.Duration
+	// Backoff how long a failed harvest is answered from memory instead of trying again, 0 to always try
+	Backoff time.Duration
+
+	mu        sync.Mutex
+	v         Vocabularies
+	harvested time.Time
+	// failed when the last harvest failed and why, until it's older than the backoff
+	failed time.Time
+	err    error
+	// running closed once the harvest in progress is done, nil when there's none
+	running chan struct{}
+}
+
+// NewCache a cache that harvests again once the vocabularies are older than ttl
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{TTL: ttl, Backoff: DefaultBackoff}
+}
+
+// Get the cached vocabularies, harvesting them when missing or stale. A failed harvest keeps serving the stale lists.
+// Only one caller harvests at a time, the others wait for it or until their ctx is done
+func (c *Cache) Get(ctx context.Context, f fetch.Fetcher, baseURL string) (Vocabularies, error) {
+
+	c.mu.Lock()
+
+	for {
+		if !c.harvested.IsZero() && time.Since(c.harvested) < c.TTL {
+			defer c.mu.Unlock()
+			return c.v, nil
+		}
+
+		if !c.failed.IsZero() && time.Since(c.failed) < c.Backoff {
+			defer c.mu.Unlock()
+			return c.stale(c.err)
+		}
+
+		if c.running == nil {
+			break
+		}
+
+		running := c.running
+		c.mu.Unlock()
+
+		select {
+		case <-running:
+			c.mu.Lock()
+		case <-ctx.Done():
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.stale(ctx.Err())
+		}
+	}
+
+	running := make(chan struct{})
+	c.running = running
+	c.mu.Unlock()
+
+	v, err := Harvest(ctx, f, baseURL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.running = nil
+	close(running)
+
+	if err == nil {
+		c.v, c.harvested = v, time.Now()
+		c.failed, c.err = time.Time{}, nil
+		return c.v, nil
+	}
+
+	//A caller that ran out of time says nothing about the site, the next one tries again
+	if !parse.GaveUp(err) {
+		c.failed, c.err = time.Now(), err
+	}
+
+	return c.stale(err)
+}
+
+// stale the lists harvested before when there are some, the error otherwise
+func (c *Cache) stale(err error) (Vocabularies, error) {
+
+	if !c.harvested.IsZero() {
+		return c.v, nil
+	}
+
+	return Vocabularies{}, err
+}
+
+// InvalidValueError a form value that isn't one of the dropdown options
+type InvalidValueError struct {
+	// Parameter the request parameter, SD, ST, PD or CT
+	Parameter string
+	Value     string
+	Hint      string
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("unknown %s value %q, %s", e.Parameter, e.Value, e.Hint)
+}
+
+// Unwrap carries the validation catalogue code
+func (e *InvalidValueError) Unwrap() error {
+	return problem.New(problem.CodeValidation, e.Error())
+}
+
+// Validate check the dropdown fields of an address against the option lists. A list that came back empty isn't checked
+func (v Vocabularies) Validate(a lookup.Address) error {
+
+	postDirections := v.PostDirections
+	if len(postDirections) == 0 {
+		postDirections = v.StreetDirections
+	}
+
+	for _, field := range []struct {
+		parameter string
+		value     string
+		options   []Option
+	}{
+		{"SD", a.StreetDirection, v.StreetDirections},
+		{"ST", a.StreetType, v.StreetTypes},
+		{"PD", a.PostDirection, postDirections},
+		{"CT", a.City, v.Cities},
+	} {
+		if err := check(field.parameter, field.value, field.options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check a value against its options, suggesting the code when the display name was given instead
+func check(parameter string, value string, options []Option) error {
+
+	value = strings.TrimSpace(value)
+	if value == "" || len(options) == 0 {
+		return nil
+	}
+
+	for _, o := range options {
+		if o.Value == value {
+			return nil
+		}
+	}
+
+	values := []string{}
+	for _, o := range options {
+		if strings.EqualFold(o.Value, value) || strings.EqualFold(o.Label, value) {
+			return &InvalidValueError{parameter, value, fmt.Sprintf("did you mean %s (%s)?", o.Value, o.Label)}
+		}
+		values = append(values, o.Value)
+	}
+
+	sort.Strings(values)
+
+	return &InvalidValueError{parameter, value, "expected one of " + strings.Join(values, ", ")}
+}
@@ -0,0 +1,128 @@
+package vocab
+
+import (
+	"app/shared/fetch"
+	"app/shared/lookup"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvest(t *testing.T) {
+
+	v, err := Harvest(context.Background(), fetch.NewFixtures("../../../testdata/bcpa"), "http://www.bcpa.net/")
+	assert.Nil(t, err)
+
+	//The blank any entry is left out
+	assert.Len(t, v.StreetDirections, 8)
+	assert.Equal(t, Option{Value: "AVE", Label: "Avenue"}, v.StreetTypes[0])
+	assert.Len(t, v.PostDirections, 4)
+	assert.Equal(t, "LS", v.CityCodes()["LAUDERDALE BY THE SEA"])
+
+	assert.Nil(t, v.Validate(lookup.Address{StreetDirection: "N", StreetType: "BLVD", City: "FL"}))
+
+	var ie *InvalidValueError
+
+	err = v.Validate(lookup.Address{StreetType: "BLVD", City: "Fort Lauderdale"})
+	if assert.True(t, errors.As(err, &ie)) {
+		assert.Equal(t, "CT", ie.Parameter)
+		assert.Contains(t, err.Error(), "did you mean FL")
+	}
+
+	err = v.Validate(lookup.Address{PostDirection: "NE"})
+	if assert.True(t, errors.As(err, &ie)) {
+		assert.Equal(t, "PD", ie.Parameter)
+		assert.Contains(t, err.Error(), "expected one of E, N, S, W")
+	}
+}
+
+func TestCacheKeepsStaleListsWhenHarvestFails(t *testing.T) {
+
+	c := NewCache(0)
+	c.Backoff = 0
+
+	_, err := c.Get(context.Background(), fetch.NewFixtures(t.TempDir()), "http://www.bcpa.net/")
+	assert.NotNil(t, err)
+
+	v, err := c.Get(context.Background(), fetch.NewFixtures("../../../testdata/bcpa"), "http://www.bcpa.net/")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, v.Cities)
+
+	//Stale, and the site is down
+	v, err = c.Get(context.Background(), fetch.NewFixtures(t.TempDir()), "http://www.bcpa.net/")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, v.Cities)
+}
+
+// countingFetcher counts the fetches, holding each until release is closed when there's one
+type countingFetcher struct {
+	fetch.Fetcher
+	release chan struct{}
+	fetches int32
+}
+
+func (f *countingFetcher) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+
+	atomic.AddInt32(&f.fetches, 1)
+	if f.release != nil {
+		<-f.release
+	}
+
+	return f.Fetcher.Get(ctx, rawURL)
+}
+
+func TestCacheBacksOffAfterFailedHarvest(t *testing.T) {
+
+	c := NewCache(time.Hour)
+	f := &countingFetcher{Fetcher: fetch.NewFixtures(t.TempDir())}
+
+	_, err := c.Get(context.Background(), f, "http://www.bcpa.net/")
+	assert.NotNil(t, err)
+
+	//The failure is remembered, the site isn't asked again until the backoff is over
+	_, again := c.Get(context.Background(), f, "http://www.bcpa.net/")
+	assert.Equal(t, err, again)
+	assert.Equal(t, int32(1), f.fetches)
+
+	c.failed = time.Now().Add(-c.Backoff)
+	f.Fetcher = fetch.NewFixtures("../../../testdata/bcpa")
+
+	v, err := c.Get(context.Background(), f, "http://www.bcpa.net/")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, v.Cities)
+	assert.Equal(t, int32(2), f.fetches)
+}
+
+func TestCacheHarvestsOnce(t *testing.T) {
+
+	c := NewCache(time.Hour)
+	f := &countingFetcher{Fetcher: fetch.NewFixtures("../../../testdata/bcpa"), release: make(chan struct{})}
+
+	harvested := make(chan error)
+	go func() {
+		_, err := c.Get(context.Background(), f, "http://www.bcpa.net/")
+		harvested <- err
+	}()
+
+	for atomic.LoadInt32(&f.fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//A caller waiting on the harvest gives up with its ctx, without holding up the others
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, f, "http://www.bcpa.net/")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(f.release)
+	assert.Nil(t, <-harvested)
+
+	v, err := c.Get(context.Background(), f, "http://www.bcpa.net/")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, v.Cities)
+	assert.Equal(t, int32(1), f.fetches)
+}
@@ -2,61 +2,130 @@ package main
 
 import (
 	"app/model"
+	"app/shared/address"
+	"app/shared/archive"
+	"app/shared/cache"
+	"app/shared/fetch"
+	"app/shared/lookup"
+	"app/shared/normalize"
 	"app/shared/parse"
+	"app/shared/problem"
+	"app/shared/vocab"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"gopkg.in/headzoo/surf.v1"
 )
 
 var (
-	_bcpa    model.Bcpa
-	_baseURL = "http://www.bcpa.net/"
-)
+	_baseURL = lookup.DefaultBaseURL
 
-// GenericError base error message
-type GenericError struct {
-	Message string `json:"message"`
-	Code    string `json:"code"`
-	Object  string `json:"object"`
-}
+	// _breaker fails the lookups fast while BCPA is down
+	_breaker = fetch.NewBreaker(fetch.NewLive())
 
-// ************************************************************************ Functions
+	// _fetcher retrieves the BCPA pages, tests swap it for saved fixtures
+	_fetcher fetch.Fetcher = _breaker
 
-// GenerateError function to create base error message
-func GenerateError(m string, c string, o string) GenericError {
-	genericError := GenericError{m, c, o}
-	return genericError
-}
+	// _vocab the RecAddr.asp dropdown option lists, harvested once a day
+	_vocab = vocab.NewCache(24 * time.Hour)
 
-// GenerateErrorString function to create base error message
-func GenerateErrorString(m string, c string, o string) ([]byte, error) {
-	genericError := GenerateError(m, c, o)
-	ge, err := json.Marshal(genericError)
-	return ge, err
-}
+	// _profiles the selector profiles a request can pin with the profile parameter
+	_profiles = parse.NewProfiles()
+
+	// _archive keeps the raw pages of every lookup, nil when archiving is off
+	_archive archive.Store
+
+	// _cache answers the parcel, card and sketch pages it has fresh, nil when caching is off
+	_cache *cache.Cache
+
+	// _flights collapses concurrent lookups of the same parcel into one scrape
+	_flights = lookup.NewFlights()
+
+	// _deadlineMargin the time kept back from the Lambda deadline to answer with what the lookup has so far
+	_deadlineMargin = 500 * time.Millisecond
+)
+
+// Response shapes a client can ask for with the shape parameter
+const (
+	ShapeRaw   = "raw"
+	ShapeTyped = "typed"
+)
+
+// ************************************************************************ Functions
 
-// GenerateErrorResponse function to create base error message with events.APIGatewayProxyResponse
-func GenerateErrorResponse(m string, c string, o string) (events.APIGatewayProxyResponse, error) {
-	ge, err := GenerateErrorString(m, c, o)
+// GenerateProblemResponse function to create an RFC 7807 problem message with events.APIGatewayProxyResponse
+func GenerateProblemResponse(p problem.Problem) (events.APIGatewayProxyResponse, error) {
+	pb, err := p.Marshal()
 
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Body:       string(ge),
+		StatusCode: p.Status,
+		Body:       string(pb),
 		Headers: map[string]string{
-			"Content-Type": "text/json",
+			"Content-Type": problem.ContentType,
 		},
 	}, nil
 }
 
+// GenerateErrorResponse function to create a problem message from the error catalogue, p names the parameter at fault if any
+func GenerateErrorResponse(c problem.Code, detail string, p string) (events.APIGatewayProxyResponse, error) {
+	pr := problem.NewProblem(c, detail)
+	pr.Parameter = p
+	return GenerateProblemResponse(pr)
+}
+
+// GenerateUpstreamErrorResponse function to create a problem message for an error raised while fetching or parsing BCPA pages
+func GenerateUpstreamErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	return GenerateProblemResponse(problem.FromError(err))
+}
+
+// GenerateCandidatesResponse function to create the ambiguous match message listing the parcels to choose from
+func GenerateCandidatesResponse(detail string, candidates []model.ParcelSearchResult) (events.APIGatewayProxyResponse, error) {
+	pr := problem.NewProblem(problem.CodeAmbiguousMatch, detail)
+	pr.Candidates = candidates
+	return GenerateProblemResponse(pr)
+}
+
+// GenerateLookupErrorResponse function to create the problem message for an error returned by a lookup, listing the candidates of an ambiguous match
+func GenerateLookupErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	var ce *lookup.CandidatesError
+	if errors.As(err, &ce) {
+		return GenerateCandidatesResponse(ce.Error(), ce.Candidates)
+	}
+	return GenerateUpstreamErrorResponse(err)
+}
+
+// GenerateInvalidValueResponse function to create the validation message for an address field that isn't one of the form's options
+func GenerateInvalidValueResponse(err error) (events.APIGatewayProxyResponse, error) {
+	p := ""
+	var ie *vocab.InvalidValueError
+	if errors.As(err, &ie) {
+		p = ie.Parameter
+	}
+	return GenerateErrorResponse(problem.CodeValidation, err.Error(), p)
+}
+
+// MarshalShape marshal the record as raw strings or as its typed companion
+func MarshalShape(bcpa model.Bcpa, shape string) string {
+	if shape == ShapeTyped {
+		return normalize.MarshalBcpa(bcpa)
+	}
+	return parse.MarshalBcpa(bcpa)
+}
+
 // GenericAPIProxyResponse function to create base response message with events.APIGatewayProxyResponse
 func GenericAPIProxyResponse(c int, b string, h map[string]string) (events.APIGatewayProxyResponse, error) {
 	return events.APIGatewayProxyResponse{
@@ -67,139 +136,451 @@ func GenericAPIProxyResponse(c int, b string, h map[string]string) (events.APIGa
 }
 
 // Handler is executed by AWS Lambda in the main function. Once the request
-// is processed, it returns an Amazon API Gateway response object to AWS Lambda
-func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// is processed, it returns an Amazon API Gateway response object to AWS Lambda.
+// A lookup still running near the deadline stops and answers with the record so far, marked incomplete
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-_deadlineMargin))
+		defer cancel()
+	}
 
-	// Create a new browser and open reddit.
-	bow := surf.NewBrowser()
-	err := bow.Open(_baseURL + "RecAddr.asp")
+	//Whether BCPA is answering and parsing
+	if request.Path == "/health" {
+		return HealthHandler()
+	}
 
-	//Ensure no error opening page
+	//The address form's option lists
+	if request.Path == "/metadata" || strings.HasPrefix(request.Path, "/metadata/") {
+		return MetadataHandler(ctx, strings.TrimPrefix(request.Path, "/metadata"))
+	}
+
+	//Raw strings as scraped or the typed companion
+	shape := request.QueryStringParameters["shape"]
+	if shape != "" && shape != ShapeRaw && shape != ShapeTyped {
+		return GenerateErrorResponse(problem.CodeValidation, "Invalid shape, expected raw or typed", "shape")
+	}
+
+	//Parse with a pinned selector profile, handy when debugging a layout change
+	profile, err := _profiles.Get(request.QueryStringParameters["profile"])
+	if err != nil {
+		return GenerateErrorResponse(problem.CodeValidation, err.Error(), "profile")
+	}
+
+	//Cache-Control style directives, no-cache to fetch everything again
+	control, err := cache.ParseControl(request.QueryStringParameters["cache"])
 	if err != nil {
-		return GenerateErrorResponse(err.Error()+" - Error while opening: "+_baseURL+"RecAddr.asp ", "1", "")
+		return GenerateErrorResponse(problem.CodeValidation, err.Error(), "cache")
 	}
 
-	if len(request.QueryStringParameters) < 6 {
+	p := NewPipeline(profile, control)
 
-		return GenerateErrorResponse("Parameters: Invalid Parameter Length", "2", "")
+	//A folio goes straight to the parcel page, no need for the address form
+	if folio, ok := request.QueryStringParameters["folio"]; ok {
+		return FolioHandler(ctx, folio, shape, p)
+	}
+
+	//An owner name uses BCPA's owner search instead of the address form
+	if owner, ok := request.QueryStringParameters["owner"]; ok {
+		return OwnerHandler(ctx, owner, request.QueryStringParameters["hydrate"] == "true", shape, p)
+	}
+
+	//A free text address is split into the form fields for the client
+	if raw, ok := request.QueryStringParameters["address"]; ok {
+		return AddressHandler(ctx, raw, shape, p)
 	}
 
 	SitusStreetNumber, ok := request.QueryStringParameters["SN"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters:Missing Street Number", "3", SitusStreetNumber)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing street number", "SN")
 	}
 
 	SitusUnitNumber, ok := request.QueryStringParameters["UN"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters: Missing Unit Number", "4", SitusUnitNumber)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing unit number", "UN")
 	}
 
 	SitusStreetDirection, ok := request.QueryStringParameters["SD"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters: Missing Street Direction", "5", SitusStreetDirection)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing street direction", "SD")
 	}
 
 	SitusStreetName, ok := request.QueryStringParameters["HN"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters: Missing Street Name", "6", SitusStreetName)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing street name", "HN")
 	}
 
 	SitusStreetType, ok := request.QueryStringParameters["ST"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters: Missing Street Type", "7", SitusStreetType)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing street type", "ST")
 	}
 
 	SitusStreetPostDir, ok := request.QueryStringParameters["PD"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters: Missing Street Post Direction", "8", SitusStreetPostDir)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing street post direction", "PD")
 	}
 
 	City, ok := request.QueryStringParameters["CT"]
 
 	if !ok {
-		return GenerateErrorResponse("Parameters: Missing City", "9", City)
+		return GenerateErrorResponse(problem.CodeValidation, "Missing city", "CT")
 	}
 
-	// Submit the search form
-	fm, _ := bow.Form("[name='homeind']")
-	fm.Input("Situs_Street_Number", SitusStreetNumber)
-	fm.SelectByOptionValue("Situs_Street_Direction", SitusStreetDirection)
-	fm.Input("Situs_Street_Name", SitusStreetName)
-	fm.SelectByOptionValue("Situs_Street_Type", SitusStreetType)
-	fm.Input("Situs_Street_Post_Dir", SitusStreetPostDir)
-	fm.Input("Situs_Unit_Number", SitusUnitNumber)
-	fm.SelectByOptionValue("Situs_City", City)
+	a := lookup.Address{
+		StreetNumber:    SitusStreetNumber,
+		UnitNumber:      SitusUnitNumber,
+		StreetDirection: SitusStreetDirection,
+		StreetName:      SitusStreetName,
+		StreetType:      SitusStreetType,
+		PostDirection:   SitusStreetPostDir,
+		City:            City,
+	}
 
-	if fm.Submit() != nil {
-		return GenerateErrorResponse(err.Error(), "1.1", "")
+	//The form ignores a value that isn't one of its options, reject it instead of searching without it
+	if err := ValidateAddress(ctx, a); err != nil {
+		return GenerateInvalidValueResponse(err)
 	}
 
-	doc, err := goquery.NewDocument(bow.Url().String())
+	//Submit the address form and load the parcel it lands on.
+	//Sections that fail are listed in the record's errors, the rest is still returned
+	bcpa, err := p.ByAddress(ctx, a)
 	if err != nil {
-		return GenerateErrorResponse(err.Error(), "1.1", "")
+		return GenerateLookupErrorResponse(err)
 	}
 
-	//Load the BCPA parent node from the HTML receieved from URL
-	_bcpa = parse.LoadBcpaFromDoc(doc)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       MarshalShape(bcpa, shape),
+		Headers: CacheHeaders(p, map[string]string{
+			"Content-Type": "text/json",
+		}),
+	}, nil
 
-	//Load the class level BCPA object with with assessments
-	parse.LoadAppendPropertyAssessments(doc, &_bcpa)
+}
 
-	//load exemptions
-	parse.LoadAppendExemptionsTaxable(doc, &_bcpa)
+// AddressHandler split a free text address like "1234 NE 5th Ave Apt 2, Fort Lauderdale" into the form fields and look it up
+func AddressHandler(ctx context.Context, raw string, shape string, p *lookup.Pipeline) (events.APIGatewayProxyResponse, error) {
 
-	//Load Sales History
-	parse.LoadSalesHistory(doc, &_bcpa)
+	//Match the city names the form currently offers
+	parser := address.NewParser()
+	if v, err := _vocab.Get(ctx, _fetcher, _baseURL); err == nil && len(v.Cities) > 0 {
+		parser.Cities = v.CityCodes()
+	}
 
-	//Load the Land Calculations
-	parse.LoadLandCalculations(doc, &_bcpa)
+	a, err := parser.Parse(raw)
+	if err != nil {
+		return GenerateErrorResponse(problem.CodeValidation, err.Error(), "address")
+	}
 
-	//Load the Special Assessments
-	parse.LoadSpecialAssessments(doc, &_bcpa)
+	if err = ValidateAddress(ctx, a); err != nil {
+		return GenerateErrorResponse(problem.CodeValidation, err.Error(), "address")
+	}
 
-	//Check if we have a URL for the CARD page. If so Parse it for data
-	if len(_bcpa.LandCalculations.Cards) > 0 {
+	bcpa, err := p.ByAddress(ctx, a)
+	if err != nil {
+		return GenerateLookupErrorResponse(err)
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       MarshalShape(bcpa, shape),
+		Headers: CacheHeaders(p, map[string]string{
+			"Content-Type": "text/json",
+		}),
+	}, nil
+}
 
-		//Let's loop the cards if more then one
-		i := 0
-		for _, card := range _bcpa.LandCalculations.Cards {
+// NewPipeline a pipeline of its own for each lookup, nothing a lookup builds outlives its request
+func NewPipeline(profile *parse.Profile, control cache.Control) *lookup.Pipeline {
+	p := lookup.NewPipeline(_fetcher, _baseURL)
+	p.Profile = profile
+	p.Archive = _archive
+	p.Cache, p.CacheControl = _cache, control
+	p.Flights = _flights
+	return p
+}
 
-			//Grab the URL from the card
-			CardURL, error := url.QueryUnescape(card.CardURL)
+// CacheHeaders add X-Cache, HIT, PARTIAL or MISS, and the Age in seconds of the oldest cached page to the headers
+func CacheHeaders(p *lookup.Pipeline, headers map[string]string) map[string]string {
 
-			if error != nil {
-				log.Fatal(error)
-			}
+	status, ok := p.CacheStatus()
+	if !ok {
+		return headers
+	}
+
+	headers["X-Cache"] = status.String()
+	if status.Hits > 0 {
+		headers["Age"] = strconv.Itoa(int(status.Age(time.Now()).Seconds()))
+	}
 
-			//Start parseing the page
-			error = parse.ExtractCardURL(CardURL, i, &_bcpa, _baseURL)
+	return headers
+}
 
-			//Increment
-			i++
+// ValidateAddress check the dropdown fields of an address against the RecAddr.asp option lists
+func ValidateAddress(ctx context.Context, a lookup.Address) error {
 
-			if error != nil {
-				log.Fatal(error)
-			}
+	v, err := _vocab.Get(ctx, _fetcher, _baseURL)
+	if err != nil {
+		//Without the lists the search itself is the judge
+		log.Printf("address vocabularies unavailable, not validating: %v", err)
+		return nil
+	}
+
+	return v.Validate(a)
+}
+
+// MetadataHandler serve the RecAddr.asp option lists, all of them or the one named by the path
+func MetadataHandler(ctx context.Context, name string) (events.APIGatewayProxyResponse, error) {
 
+	v, err := _vocab.Get(ctx, _fetcher, _baseURL)
+	if err != nil {
+		return GenerateUpstreamErrorResponse(err)
+	}
+
+	var body interface{} = v
+
+	if name = strings.Trim(name, "/"); name != "" {
+		lists := v.Lists()
+
+		list, ok := lists[name]
+		if !ok {
+			names := []string{}
+			for n := range lists {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return GenerateErrorResponse(problem.CodeValidation, "Unknown list "+name+", expected one of "+strings.Join(names, ", "), "path")
 		}
+
+		body = list
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return GenerateErrorResponse(problem.CodeInternal, err.Error(), "")
 	}
 
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
-		Body:       string(parse.MarshalBcpa(_bcpa)),
+		Body:       string(b),
 		Headers: map[string]string{
-			"Content-Type": "text/json",
+			"Content-Type":  "text/json",
+			"Cache-Control": "max-age=3600",
+		},
+	}, nil
+}
+
+// Health states
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// Health what the health endpoint reports
+type Health struct {
+	// Status down while the breaker is open, degraded while it's trying BCPA again or pages stop parsing
+	Status  string             `json:"status"`
+	Breaker fetch.BreakerState `json:"breaker"`
+	Parse   ParseHealth        `json:"parse"`
+	// InFlight lookups scraping right now
+	InFlight int `json:"inFlight"`
+}
+
+// ParseHealth how many of the recent parcel and card pages parsed
+type ParseHealth struct {
+	Checked int      `json:"checked"`
+	Parsed  int      `json:"parsed"`
+	Rate    *float64 `json:"rate,omitempty"`
+}
+
+// HealthHandler report the breaker, the last time BCPA answered and how well its pages parse. Answers 503 while
+// the breaker is open so a load balancer can tell
+func HealthHandler() (events.APIGatewayProxyResponse, error) {
+
+	h := Health{Status: HealthOK, Breaker: _breaker.State(), InFlight: _flights.InFlight()}
+
+	h.Parse.Checked, h.Parse.Parsed = parse.Checks.Counts()
+	if h.Parse.Checked > 0 {
+		rate := float64(h.Parse.Parsed) / float64(h.Parse.Checked)
+		h.Parse.Rate = &rate
+
+		//A few bad pages can be bad parcels, most of them is the layout
+		if h.Parse.Checked >= 10 && rate < 0.9 {
+			h.Status = HealthDegraded
+		}
+	}
+
+	status := 200
+	switch h.Breaker.State {
+	case fetch.BreakerOpen:
+		h.Status, status = HealthDown, 503
+	case fetch.BreakerHalfOpen:
+		h.Status = HealthDegraded
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return GenerateErrorResponse(problem.CodeInternal, err.Error(), "")
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(b),
+		Headers: map[string]string{
+			"Content-Type":  "text/json",
+			"Cache-Control": "no-store",
 		},
 	}, nil
+}
+
+// FolioHandler load the parcel page for a folio / parcel ID without the address round-trip
+func FolioHandler(ctx context.Context, folio string, shape string, p *lookup.Pipeline) (events.APIGatewayProxyResponse, error) {
+
+	folio, err := parse.NormalizeFolio(folio)
+	if err != nil {
+		return GenerateErrorResponse(problem.CodeValidation, err.Error(), "folio")
+	}
+
+	bcpa, err := p.ByFolio(ctx, folio)
+	if err != nil {
+		return GenerateLookupErrorResponse(err)
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       MarshalShape(bcpa, shape),
+		Headers: CacheHeaders(p, map[string]string{
+			"Content-Type": "text/json",
+		}),
+	}, nil
+}
+
+// OwnerHandler submit the BCPA owner name search and return the matching parcels, optionally with the full record for each
+func OwnerHandler(ctx context.Context, owner string, hydrate bool, shape string, p *lookup.Pipeline) (events.APIGatewayProxyResponse, error) {
+
+	if strings.TrimSpace(owner) == "" {
+		return GenerateErrorResponse(problem.CodeValidation, "Missing owner name", "owner")
+	}
+
+	results, err := p.ByOwner(ctx, owner, hydrate)
+	if err != nil {
+		return GenerateLookupErrorResponse(err)
+	}
+
+	if hydrate && shape == ShapeTyped {
+		for i := range results {
+			//Left unhydrated when the lookup ran out of time
+			if results[i].Bcpa == nil {
+				continue
+			}
+			typed := normalize.Bcpa(*results[i].Bcpa)
+			results[i].Typed, results[i].Bcpa = &typed, nil
+		}
+	}
 
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       parse.MarshalSearchResults(results),
+		Headers: CacheHeaders(p, map[string]string{
+			"Content-Type": "text/json",
+		}),
+	}, nil
 }
 
 func main() {
+
+	//Run as a plain HTTP server when an address is given, AWS Lambda otherwise
+	addr := flag.String("http", os.Getenv("BCPA_HTTP_ADDR"), "serve over plain HTTP on this address (e.g. :8080) instead of AWS Lambda, or set BCPA_HTTP_ADDR")
+	public := flag.String("public", envOr("BCPA_PUBLIC_DIR", "public"), "directory of the public assets served in HTTP mode, or set BCPA_PUBLIC_DIR")
+	profiles := flag.String("profiles", os.Getenv("BCPA_PROFILES"), "selector profile file or directory of .json / .yaml profiles, or set BCPA_PROFILES")
+	profilePages := flag.String("profile-pages", os.Getenv("BCPA_PROFILE_PAGES"), "directory of saved BCPA pages every profile must match before starting, or set BCPA_PROFILE_PAGES")
+	archiveSpec := flag.String("archive", os.Getenv("BCPA_ARCHIVE"), "archive the raw pages of every lookup to this directory or s3://bucket/prefix, or set BCPA_ARCHIVE")
+	cacheSpec := flag.String("cache", envOr("BCPA_CACHE", "memory"), "cache the parcel pages in memory or in this directory, empty for no cache, or set BCPA_CACHE")
+	cacheTTL := flag.String("cache-ttl", os.Getenv("BCPA_CACHE_TTL"), "cache time to live per section like parcel=24h,card=720h,sketch=720h,address=720h, or set BCPA_CACHE_TTL")
+	upstream := flag.String("upstream", os.Getenv("BCPA_UPSTREAM"), "request budget for bcpa.net like rps=2,concurrency=4,retries=3,backoff=500ms,max-backoff=10s,timeout=15s, or set BCPA_UPSTREAM")
+	userAgent := flag.String("user-agent", envOr("BCPA_USER_AGENT", fetch.DefaultUserAgent), "User-Agent sent to bcpa.net, or set BCPA_USER_AGENT")
+	breaker := flag.String("breaker", os.Getenv("BCPA_BREAKER"), "circuit breaker settings like failures=5,cooldown=30s, or set BCPA_BREAKER")
+	flag.Parse()
+
+	//Every lookup shares one budget, the search form submits included
+	polite := fetch.NewPolite()
+	if err := polite.Configure(*upstream); err != nil {
+		log.Fatal(err)
+	}
+	polite.UserAgent = *userAgent
+
+	if err := _breaker.Configure(*breaker); err != nil {
+		log.Fatal(err)
+	}
+	_breaker.Fetcher = fetch.NewLiveThrough(polite)
+
+	store, err := archive.Open(*archiveSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_archive = store
+
+	cacheStore, err := cache.Open(*cacheSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cacheStore != nil {
+		ttls, err := cache.ParseTTLs(*cacheTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_cache = cache.New(cacheStore, ttls)
+	}
+
+	if *profiles != "" {
+		ps, err := LoadProfiles(*profiles, *profilePages)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_profiles = ps
+	}
+
+	if *addr != "" {
+		log.Fatal(Serve(*addr, *public))
+	}
+
 	lambda.Start(Handler)
 }
+
+// envOr value of the environment variable or the fallback when it's not set
+func envOr(key string, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+// LoadProfiles load the selector profiles, when a directory of saved pages is given every profile must match them
+func LoadProfiles(path string, pagesDir string) (*parse.Profiles, error) {
+
+	ps, err := parse.LoadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if pagesDir != "" {
+		for _, version := range ps.Versions() {
+			p, _ := ps.Get(version)
+			if errs := parse.ValidateProfile(p, pagesDir); len(errs) > 0 {
+				return nil, fmt.Errorf("profile %s doesn't match the pages in %s: %v", version, pagesDir, errs)
+			}
+		}
+	}
+
+	log.Printf("selector profiles %s, default %s", strings.Join(ps.Versions(), ", "), ps.Default.Version)
+
+	return ps, nil
+}
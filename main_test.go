@@ -1,26 +1,549 @@
 package main
 
 import (
+	"app/model"
+	"app/shared/archive"
+	"app/shared/cache"
+	"app/shared/fetch"
+	"app/shared/parse"
+	"app/shared/problem"
+	"app/shared/vocab"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sync"
 	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
 )
 
-func TestHandler(t *testing.T) {
+func TestMain(m *testing.M) {
+	//Run the whole pipeline against the saved BCPA pages
+	_fetcher = fetch.NewFixtures("testdata/bcpa")
+	os.Exit(m.Run())
+}
+
+func addressRequest(sn string, sd string, hn string, st string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{
+			"SN": sn,
+			"UN": "",
+			"SD": sd,
+			"HN": hn,
+			"ST": st,
+			"PD": "",
+			"CT": "FL",
+		},
+	}
+}
+
+func TestHandlerFolio(t *testing.T) {
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "5042-03-06-0330"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	bcpa := model.Bcpa{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &bcpa))
+
+	assert.Equal(t, "1234 NE 5 AVENUE FORT LAUDERDALE FL 33304", bcpa.Siteaddress)
+	assert.Equal(t, "SMITH, JOHN & SMITH, JANE", bcpa.Owner)
+	assert.Equal(t, "504203060330", bcpa.ID)
+	assert.Equal(t, "01-01 Single Family", bcpa.Use)
+	assert.Len(t, bcpa.PropertyAssessments, 3)
+	assert.Equal(t, "$96,750", bcpa.PropertyAssessments[0].Land)
+	assert.Equal(t, "$25,000", bcpa.ExemptionsTaxable.County.Homestead)
+	assert.Len(t, bcpa.SalesHistory, 2)
+	assert.Equal(t, "05/12/2009", bcpa.SalesHistory[0].Date)
+	assert.Len(t, bcpa.LandCalculations.Calculations, 1)
+	assert.Equal(t, "2,345", bcpa.LandCalculations.AdjBldgSF)
+	assert.Equal(t, "1985/1972", bcpa.LandCalculations.EffActYearBuilt)
+	assert.Len(t, bcpa.SpecialAssessments, 1)
+
+	if assert.Len(t, bcpa.LandCalculations.Cards, 1) {
+		card := bcpa.LandCalculations.Cards[0]
+		assert.Equal(t, "504203060330", card.Folio)
+		assert.Equal(t, "2018", card.TaxYear)
+		assert.Equal(t, "3", card.NoBedrooms)
+		assert.Equal(t, "CB Stucco", card.Exterior)
+		assert.Len(t, card.Permits, 2)
+		assert.Len(t, card.ExtraFeatures, 3)
+	}
+
+	if assert.NotNil(t, bcpa.LandCalculations.Sketch) {
+		assert.Len(t, bcpa.LandCalculations.Sketch.Codes, 5)
+		assert.Equal(t, "2,345", bcpa.LandCalculations.Sketch.AdjAreaTotal)
+		assert.Equal(t, "http://www.bcpa.net/SketchImages/504203060330_1.jpg", bcpa.LandCalculations.Sketch.SketchImgURL)
+	}
+}
+
+func TestHandlerProvenance(t *testing.T) {
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	bcpa := model.Bcpa{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &bcpa))
+
+	if !assert.NotNil(t, bcpa.Provenance) {
+		return
+	}
+
+	assert.Equal(t, parse.ParserVersion, bcpa.Provenance.ParserVersion)
+	assert.Equal(t, "2018.1", bcpa.Provenance.ProfileVersion)
+
+	sections := []string{}
+	for _, s := range bcpa.Provenance.Sources {
+		sections = append(sections, s.Section)
+		assert.False(t, s.FetchedAt.IsZero(), s.Section)
+	}
+	assert.Equal(t, []string{"parcel", "card 1", "sketch"}, sections)
+
+	//The hash is of the HTML exactly as fetched
+	body, err := os.ReadFile("testdata/bcpa/RecInfo.asp_URL_Folio_504203060330.html")
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(body)), bcpa.Provenance.Sources[0].SHA256)
+	assert.Equal(t, "http://www.bcpa.net/RecInfo.asp?URL_Folio=504203060330", bcpa.Provenance.Sources[0].URL)
+}
+
+func TestHandlerAddressMultipleCards(t *testing.T) {
+
+	response, err := Handler(context.Background(), addressRequest("2500", "N", "OCEAN", "BLVD"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	bcpa := model.Bcpa{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &bcpa))
+
+	assert.Equal(t, "494210010020", bcpa.ID)
+	if assert.Len(t, bcpa.LandCalculations.Cards, 2) {
+		assert.Equal(t, "1", bcpa.LandCalculations.Cards[0].CardNo)
+		assert.Equal(t, "2", bcpa.LandCalculations.Cards[1].CardNo)
+		assert.Len(t, bcpa.LandCalculations.Cards[1].ExtraFeatures, 2)
+	}
+}
+
+func TestHandlerFreeTextAddress(t *testing.T) {
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"address": "2500 N. Ocean Blvd, Fort Lauderdale, FL 33305"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	bcpa := model.Bcpa{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &bcpa))
+	assert.Equal(t, "494210010020", bcpa.ID)
+
+	//Asked which reading was meant rather than guessing
+	response, err = Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"address": "2500 N Ocean Blvd, FL"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+
+	p := problem.Problem{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, "address", p.Parameter)
+	assert.Contains(t, p.Detail, "the state of Florida")
+}
+
+func TestHandlerConcurrentLookups(t *testing.T) {
+
+	//Records are stamped when they're parsed, leave that out of the comparison
+	stamps := regexp.MustCompile(`"(createdat|updatedat|fetchedAt)":"[^"]*"`)
+
+	requests := []events.APIGatewayProxyRequest{
+		{QueryStringParameters: map[string]string{"folio": "504203060330"}},
+		addressRequest("2500", "N", "OCEAN", "BLVD"),
+		{QueryStringParameters: map[string]string{"owner": "SMITH JOHN", "hydrate": "true"}},
+	}
+
+	//What each lookup returns on its own
+	expected := []string{}
+	for _, request := range requests {
+		response, err := Handler(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, response.StatusCode)
+		expected = append(expected, stamps.ReplaceAllString(response.Body, ""))
+	}
+
+	//Run them side by side, a record leaking between lookups would show up as extra sales, cards or a different parcel
+	bodies := make([]string, 60)
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, _ := Handler(context.Background(), requests[i%len(requests)])
+			bodies[i] = stamps.ReplaceAllString(response.Body, "")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, body := range bodies {
+		assert.Equal(t, expected[i%len(requests)], body, "lookup %d", i)
+	}
+}
+
+func TestHandlerCandidates(t *testing.T) {
+
+	response, err := Handler(context.Background(), addressRequest("100", "E", "LAS OLAS", "BLVD"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 409, response.StatusCode)
+	assert.Equal(t, problem.ContentType, response.Headers["Content-Type"])
+
+	ce := struct {
+		Code       problem.Code
+		Candidates []model.ParcelSearchResult
+	}{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &ce))
+	assert.Equal(t, problem.CodeAmbiguousMatch, ce.Code)
+	if assert.Len(t, ce.Candidates, 2) {
+		assert.Equal(t, "504211020010", ce.Candidates[0].Folio)
+		assert.Equal(t, "100 E LAS OLAS BLVD #1 FORT LAUDERDALE", ce.Candidates[0].Siteaddress)
+	}
+}
+
+func TestHandlerNotFound(t *testing.T) {
+
+	response, err := Handler(context.Background(), addressRequest("1", "", "NOWHERE", "ST"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, response.StatusCode)
+
+	p := problem.Problem{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, problem.CodeNotFound, p.Code)
+	assert.Equal(t, "urn:bcpa:problem:not_found", p.Type)
+}
+
+func TestHandlerValidation(t *testing.T) {
+
+	request := addressRequest("1", "", "NOWHERE", "ST")
+	delete(request.QueryStringParameters, "HN")
+
+	response, err := Handler(context.Background(), request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+
+	p := problem.Problem{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, problem.CodeValidation, p.Code)
+	assert.Equal(t, "HN", p.Parameter)
+}
+
+func TestHandlerInvalidValue(t *testing.T) {
+
+	request := addressRequest("2500", "N", "OCEAN", "BOULEVARD")
+	response, err := Handler(context.Background(), request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+
+	p := problem.Problem{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, "ST", p.Parameter)
+	assert.Contains(t, p.Detail, "did you mean BLVD")
+
+	request.QueryStringParameters["ST"] = "BLVD"
+	request.QueryStringParameters["CT"] = "XX"
+	response, err = Handler(context.Background(), request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, "CT", p.Parameter)
+	assert.Contains(t, p.Detail, "expected one of DA, FL, HW")
+}
+
+func TestHandlerMetadata(t *testing.T) {
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{Path: "/metadata/cities"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	cities := []vocab.Option{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &cities))
+	assert.Contains(t, cities, vocab.Option{Value: "FL", Label: "Fort Lauderdale"})
+
+	response, err = Handler(context.Background(), events.APIGatewayProxyRequest{Path: "/metadata"})
+
+	assert.Nil(t, err)
+	v := vocab.Vocabularies{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &v))
+	assert.Len(t, v.StreetDirections, 8)
+	assert.Len(t, v.StreetTypes, 11)
+
+	response, err = Handler(context.Background(), events.APIGatewayProxyRequest{Path: "/metadata/zoning"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+}
 
-	//request := events.APIGatewayProxyRequest{}
-	//expectedResponse := events.APIGatewayProxyResponse{
-	//	StatusCode: 200,
-	//	Headers: map[string]string{
-	//		"Content-Type": "text/json",
-	//	},
-	//	Body: "Congratulations",
-	//}
+func TestHandlerProfile(t *testing.T) {
+
+	ps, err := LoadProfiles("profiles", "testdata/bcpa")
+	assert.Nil(t, err)
+
+	saved := _profiles
+	_profiles = ps
+	defer func() { _profiles = saved }()
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330", "profile": "2018.1"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	response, err = Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330", "profile": "1999.1"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+
+	p := problem.Problem{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, "profile", p.Parameter)
+	assert.Contains(t, p.Detail, "expected one of 2018.1")
+}
+
+func TestHandlerArchive(t *testing.T) {
+
+	saved := _archive
+	_archive = archive.NewDir(t.TempDir())
+	defer func() { _archive = saved }()
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	keys, err := archive.Lookups(context.Background(), _archive, "504203060330")
+	assert.Nil(t, err)
+	if !assert.Len(t, keys, 1) {
+		return
+	}
+
+	m, err := archive.ReadManifest(context.Background(), _archive, keys[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "folio", m.Lookup)
+	assert.Equal(t, parse.ParserVersion, m.ParserVersion)
+	assert.Len(t, m.Pages, 3)
+
+	//An address lookup that resolves to the same parcel sits next to it
+	response, err = Handler(context.Background(), addressRequest("2500", "N", "OCEAN", "BLVD"))
+	assert.Nil(t, err)
+
+	keys, _ = archive.Lookups(context.Background(), _archive, "494210010020")
+	assert.Len(t, keys, 1, response.Body)
+}
+
+func TestHandlerCache(t *testing.T) {
+
+	saved := _cache
+	_cache = cache.New(cache.NewMemory(0), cache.DefaultTTLs)
+	defer func() { _cache = saved }()
+
+	folio := func(directives string) events.APIGatewayProxyResponse {
+		response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330", "cache": directives}})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, response.StatusCode, response.Body)
+		return response
+	}
+
+	first := folio("")
+	assert.Equal(t, "MISS", first.Headers["X-Cache"])
+	assert.Empty(t, first.Headers["Age"])
+
+	second := folio("")
+	assert.Equal(t, "HIT", second.Headers["X-Cache"])
+	assert.Equal(t, "0", second.Headers["Age"])
+
+	//The same record, down to when its pages were fetched
+	stamps := regexp.MustCompile(`"(createdat|updatedat)":"[^"]*"`)
+	assert.Equal(t, stamps.ReplaceAllString(first.Body, ""), stamps.ReplaceAllString(second.Body, ""))
+
+	assert.Equal(t, "MISS", folio("no-cache").Headers["X-Cache"])
+
+	//The second search of an address skips RecAddr.asp for the parcel it landed on
+	response, err := Handler(context.Background(), addressRequest("2500", "N", "OCEAN", "BLVD"))
+	assert.Nil(t, err)
+	assert.Equal(t, "MISS", response.Headers["X-Cache"])
+
+	response, err = Handler(context.Background(), addressRequest("2500", "N", "ocean", "BLVD"))
+	assert.Nil(t, err)
+	assert.Equal(t, "HIT", response.Headers["X-Cache"], response.Body)
+
+	bcpa := model.Bcpa{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &bcpa))
+	assert.Equal(t, "494210010020", bcpa.ID)
+	assert.Len(t, bcpa.LandCalculations.Cards, 2)
+
+	response, err = Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330", "cache": "stale-if-error"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+
+	p := problem.Problem{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &p))
+	assert.Equal(t, "cache", p.Parameter)
+}
+
+// unreachable a site that refuses every connection
+type unreachable struct{}
+
+func (unreachable) Get(ctx context.Context, rawURL string) (*fetch.Page, error) {
+	return nil, &url.Error{Op: "Get", URL: rawURL, Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+}
+
+func (u unreachable) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*fetch.Page, error) {
+	return u.Get(ctx, formURL)
+}
+
+func TestHandlerHealth(t *testing.T) {
+
+	saved, checks := _breaker, parse.Checks
+	parse.Checks = parse.NewTally(200)
+	defer func() { _breaker, parse.Checks = saved, checks }()
+
+	health := func() (int, Health) {
+		response, err := Handler(context.Background(), events.APIGatewayProxyRequest{Path: "/health"})
+		assert.Nil(t, err)
+
+		h := Health{}
+		assert.Nil(t, json.Unmarshal([]byte(response.Body), &h))
+		return response.StatusCode, h
+	}
+
+	//Answering
+	_breaker = fetch.NewBreaker(fetch.NewFixtures("testdata/bcpa"))
+	_, err := _breaker.Get(context.Background(), "http://www.bcpa.net/RecInfo.asp?URL_Folio=504203060330")
+	assert.Nil(t, err)
+
+	_, err = Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330"}})
+	assert.Nil(t, err)
+
+	status, h := health()
+	assert.Equal(t, 200, status)
+	assert.Equal(t, HealthOK, h.Status)
+	assert.Equal(t, fetch.BreakerClosed, h.Breaker.State)
+	assert.NotNil(t, h.Breaker.LastSuccess)
+	if assert.NotNil(t, h.Parse.Rate) {
+		assert.Equal(t, 1.0, *h.Parse.Rate)
+	}
+
+	//Down
+	_breaker = fetch.NewBreaker(unreachable{})
+	_breaker.Threshold = 1
+	_, err = _breaker.Get(context.Background(), "http://www.bcpa.net/RecInfo.asp?URL_Folio=504203060330")
+	assert.NotNil(t, err)
+
+	status, h = health()
+	assert.Equal(t, 503, status)
+	assert.Equal(t, HealthDown, h.Status)
+	assert.Equal(t, fetch.BreakerOpen, h.Breaker.State)
+	assert.Contains(t, h.Breaker.LastError, "connection refused")
+	assert.NotNil(t, h.Breaker.RetryAt)
+}
+
+func TestHandlerUpstreamUnavailable(t *testing.T) {
+
+	//No fixture stands in for a site that doesn't answer
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "999999999999"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 502, response.StatusCode)
+	assert.Contains(t, response.Body, string(problem.CodeUpstreamUnavailable))
+}
+
+func TestHandlerOwner(t *testing.T) {
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"owner": "SMITH JOHN", "hydrate": "true"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	results := []model.ParcelSearchResult{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &results))
+
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "504203060330", results[0].Folio)
+		assert.Equal(t, "OCEAN DUPLEX HOLDINGS LLC", results[1].Owner)
+		assert.Equal(t, "494210010020", results[1].Bcpa.ID)
+	}
+}
+
+func TestHandlerTyped(t *testing.T) {
+
+	response, err := Handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330", "shape": "typed"}})
+
+	assert.Nil(t, err)
+
+	typed := model.TypedBcpa{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &typed))
+
+	assert.Equal(t, int64(9675000), typed.PropertyAssessments[0].Land.Cents)
+	assert.Equal(t, float64(2345), typed.LandCalculations.AdjBldgSF.Value)
+	assert.Equal(t, 1985, typed.LandCalculations.EffYearBuilt.Value)
+	assert.Equal(t, 2009, typed.SalesHistory[0].Date.Time.Year())
+}
+
+// hangUp a client that hangs up once the search results are in
+type hangUp struct {
+	fetch.Fetcher
+	cancel context.CancelFunc
+}
+
+func (h *hangUp) Submit(ctx context.Context, formURL string, selector string, values url.Values) (*fetch.Page, error) {
+	page, err := h.Fetcher.Submit(ctx, formURL, selector, values)
+	h.cancel()
+	return page, err
+}
+
+func TestHandlerIncomplete(t *testing.T) {
+
+	saved := _fetcher
+	defer func() { _fetcher = saved }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_fetcher = &hangUp{Fetcher: saved, cancel: cancel}
+
+	//The search answered, none of the parcels were loaded
+	response, err := Handler(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"owner": "SMITH JOHN", "hydrate": "true", "shape": "typed"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	results := []model.ParcelSearchResult{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &results))
+
+	if assert.Len(t, results, 2) {
+		assert.True(t, results[0].Incomplete)
+		assert.Nil(t, results[0].Typed)
+		assert.Equal(t, "OCEAN DUPLEX HOLDINGS LLC", results[1].Owner)
+	}
+}
 
-	//response, _ := Handler(request)
+func TestHandlerDeadline(t *testing.T) {
 
-	//assert.Equal(t, response.Headers, expectedResponse.Headers)
-	//assert.Contains(t, response.Body, expectedResponse.Body)
-	//assert.Equal(t, err, nil)
+	//Less time left than the margin kept to answer, nothing is fetched
+	ctx, cancel := context.WithTimeout(context.Background(), _deadlineMargin/2)
+	defer cancel()
 
-	//log.Println(err)
+	response, err := Handler(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"folio": "504203060330"}})
 
+	assert.Nil(t, err)
+	assert.Equal(t, 504, response.StatusCode)
+	assert.Contains(t, response.Body, string(problem.CodeTimeout))
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"app/shared/problem"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Timeouts of the standalone HTTP server, so a slow client can't hold a connection open
+const (
+	_readHeaderTimeout = 5 * time.Second
+	_readTimeout       = 10 * time.Second
+	// _writeTimeout also the lookup deadline, like API Gateway's 29s the lookup answers with what it has before then
+	_writeTimeout = 29 * time.Second
+	_idleTimeout  = 60 * time.Second
+)
+
+// ProxyRequest build the API Gateway request the Lambda Handler expects from a plain HTTP request
+func ProxyRequest(r *http.Request) events.APIGatewayProxyRequest {
+
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:                      r.Method,
+		Path:                            r.URL.Path,
+		Headers:                         map[string]string{},
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           map[string]string{},
+		MultiValueQueryStringParameters: r.URL.Query(),
+	}
+
+	//API Gateway keeps the last value of a repeated parameter
+	for k, v := range r.URL.Query() {
+		request.QueryStringParameters[k] = v[len(v)-1]
+	}
+	for k := range r.Header {
+		request.Headers[k] = r.Header.Get(k)
+	}
+
+	return request
+}
+
+// WriteProxyResponse write an API Gateway response to a plain HTTP response
+func WriteProxyResponse(w http.ResponseWriter, response events.APIGatewayProxyResponse) {
+
+	for k, v := range response.Headers {
+		w.Header().Set(k, v)
+	}
+	for k, vs := range response.MultiValueHeaders {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.WriteHeader(response.StatusCode)
+	io.WriteString(w, response.Body)
+}
+
+// LookupServer serve the same lookups as the Lambda over plain net/http
+func LookupServer(w http.ResponseWriter, r *http.Request) {
+
+	//A client that hangs up stops the lookup, and it answers before the server gives up on writing the response
+	ctx, cancel := context.WithTimeout(r.Context(), _writeTimeout)
+	defer cancel()
+
+	response, err := Handler(ctx, ProxyRequest(r))
+	if err != nil {
+		response, _ = GenerateErrorResponse(problem.CodeInternal, err.Error(), "")
+	}
+
+	WriteProxyResponse(w, response)
+}
+
+// NewServeMux route the lookups and the public assets. Like the API Gateway deployment the lookup answers on
+// the root path, a request without a query string gets the public site instead
+func NewServeMux(publicDir string) *http.ServeMux {
+
+	assets := http.FileServer(http.Dir(publicDir))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && r.URL.RawQuery != "" {
+			LookupServer(w, r)
+			return
+		}
+		assets.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/lookup", LookupServer)
+	mux.HandleFunc("/metadata", LookupServer)
+	mux.HandleFunc("/metadata/", LookupServer)
+	mux.HandleFunc("/health", LookupServer)
+
+	return mux
+}
+
+// NewServer the standalone HTTP server, with timeouts on every stage of a connection
+func NewServer(addr string, publicDir string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           NewServeMux(publicDir),
+		ReadHeaderTimeout: _readHeaderTimeout,
+		ReadTimeout:       _readTimeout,
+		WriteTimeout:      _writeTimeout,
+		IdleTimeout:       _idleTimeout,
+	}
+}
+
+// Serve run the standalone HTTP server
+func Serve(addr string, publicDir string) error {
+	log.Printf("serving lookups on %s, public assets from %s", addr, publicDir)
+	return NewServer(addr, publicDir).ListenAndServe()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+
+	server := httptest.NewServer(NewServeMux("public"))
+	defer server.Close()
+
+	//Same query parameters and response as the Lambda
+	resp, err := http.Get(server.URL + "/?folio=504203060330")
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/json", resp.Header.Get("Content-Type"))
+		resp.Body.Close()
+	}
+
+	resp, err = http.Get(server.URL + "/lookup?folio=12")
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	//The public site is served from the same process
+	resp, err = http.Get(server.URL + "/assets/css/styles.css")
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+}
+
+func TestNewServer(t *testing.T) {
+
+	server := NewServer(":8080", "public")
+
+	assert.Equal(t, ":8080", server.Addr)
+	assert.NotZero(t, server.ReadHeaderTimeout)
+	assert.NotZero(t, server.ReadTimeout)
+	assert.NotZero(t, server.IdleTimeout)
+
+	//The lookup deadline is the write timeout, less the margin it keeps to answer
+	assert.Equal(t, _writeTimeout, server.WriteTimeout)
+	assert.True(t, _deadlineMargin < server.WriteTimeout)
+}